@@ -1,7 +1,9 @@
 package golib
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 
 	"github.com/felipefoliatti/errors"
@@ -29,6 +31,23 @@ type Database interface {
 	Do(act func(db *sqlx.DB) *errors.Error) *errors.Error
 }
 
+// Pinger é implementado pelos componentes que verificam se estão acessíveis, como o Database, o Influx e as filas
+// Ele não faz parte das interfaces dos componentes, e é obtido por uma verificação de tipo (como em server.Health)
+type Pinger interface {
+	Ping(ctx context.Context) *errors.Error
+}
+
+// Ping verifica se o componente está acessível, quando ele implementa Pinger
+// Se ele não implementar, um objeto error é retornado
+func Ping(ctx context.Context, component interface{}) *errors.Error {
+
+	pinger, ok := component.(Pinger)
+	if !ok {
+		return errors.New(fmt.Sprintf("%T does not implement Ping", component))
+	}
+	return pinger.Ping(ctx)
+}
+
 // MySqlDatabase é uma implementação concreta da interface Database para MySql
 // O nome do banco de dados é utilizado para conectar
 // A Url é o endereço para o banco de dados
@@ -271,3 +290,26 @@ func (m *mySqlDatabase) Do(act func(db *sqlx.DB) *errors.Error) *errors.Error {
 
 	return act(m.db)
 }
+
+// Ping verifica se o banco de dados está acessível, abrindo a conexão se necessário
+// Se houver um erro, um objeto error é retornado
+func (m *mySqlDatabase) Ping(ctx context.Context) *errors.Error {
+
+	var e error
+	var err *errors.Error
+
+	if m.db == nil {
+		m.db, e = sqlx.Open(*m.drivername, *m.url+*m.database+"?parseTime=true" /*+"?interpolateParams=true"*/)
+		err = errors.WrapInner("error opening the database", e, 0)
+		if err == nil {
+			m.db.SetMaxOpenConns(5)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	e = m.db.PingContext(ctx)
+	return errors.WrapInner("error pinging the database", e, 0)
+}
@@ -0,0 +1,76 @@
+package golib
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	"github.com/jmoiron/sqlx"
+)
+
+//instrumentedDatabase records the operations of a Database in the metrics
+type instrumentedDatabase struct {
+	db      Database
+	metrics Metrics
+}
+
+//NewInstrumentedDatabase wraps the database, recording each operation in the metrics:
+//the counter "database_operations" and the timer "database_operation_duration", tagged by operation and status ("ok" or "error")
+func NewInstrumentedDatabase(db Database, metrics Metrics) Database {
+	return &instrumentedDatabase{db: db, metrics: metrics}
+}
+
+func (d *instrumentedDatabase) Run(statements ...Statement) ([]sql.Result, *errors.Error) {
+	start := time.Now()
+	results, err := d.db.Run(statements...)
+	d.observe("run", start, err)
+	return results, err
+}
+
+func (d *instrumentedDatabase) RunMisc(statements ...Statement) ([]interface{}, *errors.Error) {
+	start := time.Now()
+	results, err := d.db.RunMisc(statements...)
+	d.observe("run_misc", start, err)
+	return results, err
+}
+
+func (d *instrumentedDatabase) Query(dest interface{}, statement Statement) *errors.Error {
+	start := time.Now()
+	err := d.db.Query(dest, statement)
+	d.observe("query", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) Transaction(fun func(tx *sqlx.Tx) *errors.Error) *errors.Error {
+	start := time.Now()
+	err := d.db.Transaction(fun)
+	d.observe("transaction", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) RunTx(tx *sqlx.Tx, statements ...Statement) ([]sql.Result, *errors.Error) {
+	start := time.Now()
+	results, err := d.db.RunTx(tx, statements...)
+	d.observe("run_tx", start, err)
+	return results, err
+}
+
+func (d *instrumentedDatabase) Do(act func(db *sqlx.DB) *errors.Error) *errors.Error {
+	start := time.Now()
+	err := d.db.Do(act)
+	d.observe("do", start, err)
+	return err
+}
+
+func (d *instrumentedDatabase) Ping(ctx context.Context) *errors.Error {
+	start := time.Now()
+	err := Ping(ctx, d.db)
+	d.observe("ping", start, err)
+	return err
+}
+
+//observe records an operation that started at start
+func (d *instrumentedDatabase) observe(operation string, start time.Time, err *errors.Error) {
+	ObserveOperation(d.metrics, "database", map[string]string{"operation": operation}, start, err)
+}
@@ -1,196 +1,521 @@
 package golib
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/felipefoliatti/backoff"
 	"github.com/felipefoliatti/errors"
+	uuid "github.com/satori/go.uuid"
 )
 
+//Client is a reusable HTTP client that shares the same http.Transport among the calls
+//A base url, default headers, TLS config, proxy and the transport itself can be set through ClientOption
+type Client struct {
+	baseURL      string
+	headers      map[string]string
+	codecs       map[string]Codec
+	decoders     []ErrorDecoder
+	timeout      time.Duration
+	tls          *tls.Config
+	proxy        func(*http.Request) (*url.URL, error)
+	transport    http.RoundTripper
+	middlewares  []Middleware
+	logging      *HTTPLogOptions
+	auth         Authenticator
+	breakers     *breakers
+	limiters     *limiters
+	maxErrorBody int64
+	retry        RetryPolicy
+	client       *http.Client
+}
+
+//ClientOption configures a Client when it is created
+type ClientOption func(c *Client)
+
+//WithBaseURL sets the base url, used when the url of the call is not absolute
+func WithBaseURL(base string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(base, "/")
+	}
+}
+
+//WithHeaders sets headers sent in every call
+//The headers given in the call replace these
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) {
+		for key, value := range headers {
+			c.headers[key] = value
+		}
+	}
+}
+
+//WithTimeout sets the timeout of each attempt (10 seconds by default)
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+//WithTLSConfig sets the TLS config used by the default transport
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tls = config
+	}
+}
+
+//WithProxy sets the proxy function used by the default transport (http.ProxyFromEnvironment by default)
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ClientOption {
+	return func(c *Client) {
+		c.proxy = proxy
+	}
+}
+
+//WithTransport replaces the default transport. In this case, WithTLSConfig and WithProxy are ignored
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+//NewClient creates a new Client with the given options
+func NewClient(options ...ClientOption) *Client {
+
+	c := &Client{
+		headers:      map[string]string{},
+		codecs:       defaultCodecs(),
+		decoders:     []ErrorDecoder{EnvelopeErrorDecoder, ProblemErrorDecoder},
+		timeout:      10 * time.Second,
+		proxy:        http.ProxyFromEnvironment,
+		retry:        DefaultRetryPolicy(),
+		maxErrorBody: 64 * 1024,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.transport == nil {
+		c.transport = newTransport(c.tls, c.proxy)
+	}
+
+	c.client = &http.Client{Timeout: c.timeout, Transport: chain(c.transport, c.middlewares)}
+	return c
+}
+
+//newTransport creates a transport tuned to reuse the connections among the calls
+func newTransport(config *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   15 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       config,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+//defaultClient is the Client used by the package functions (Post, Get, ...)
+var defaultClient = NewClient()
+
+//Response holds the status code, the headers and the raw body of a call
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+//Success checks if the status code is a 2xx
+func (r *Response) Success() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+//Do sends a request with the given method and, besides decoding the body into target, returns the Response
+//The Response is also returned when the call fails with a status code, so it can be inspected
+func (c *Client) Do(ctx context.Context, logger Logger, method string, url string, obj interface{}, target interface{}, headers map[string]string) (*Response, *errors.Error) {
+	return c.request(ctx, method, logger, url, obj, target, headers)
+}
+
+func (c *Client) Post(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "POST", logger, url, obj, target, headers)
+	return err
+}
+func (c *Client) Put(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "PUT", logger, url, obj, target, headers)
+	return err
+}
+func (c *Client) Patch(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "PATCH", logger, url, obj, target, headers)
+	return err
+}
+func (c *Client) Head(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "HEAD", logger, url, obj, target, headers)
+	return err
+}
+func (c *Client) Delete(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "DELETE", logger, url, obj, target, headers)
+	return err
+}
+func (c *Client) Get(logger Logger, url string, target interface{}, headers map[string]string) *errors.Error {
+	_, err := c.request(context.Background(), "GET", logger, url, nil, target, headers)
+	return err
+}
+
+func Do(ctx context.Context, logger Logger, method string, url string, obj interface{}, target interface{}, headers map[string]string) (*Response, *errors.Error) {
+	return defaultClient.Do(ctx, logger, method, url, obj, target, headers)
+}
 func Post(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	return request("POST", logger, url, obj, target, headers)
+	return defaultClient.Post(logger, url, obj, target, headers)
 }
 func Put(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	return request("PUT", logger, url, obj, target, headers)
+	return defaultClient.Put(logger, url, obj, target, headers)
 }
 func Patch(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	return request("PATCH", logger, url, obj, target, headers)
+	return defaultClient.Patch(logger, url, obj, target, headers)
 }
 func Head(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	return request("HEAD", logger, url, obj, target, headers)
+	return defaultClient.Head(logger, url, obj, target, headers)
 }
 func Delete(logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	return request("DELETE", logger, url, obj, target, headers)
+	return defaultClient.Delete(logger, url, obj, target, headers)
 }
 func Get(logger Logger, url string, target interface{}, headers map[string]string) *errors.Error {
-	return request("GET", logger, url, nil, target, headers)
+	return defaultClient.Get(logger, url, target, headers)
 }
 
-func request(method string, logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) *errors.Error {
-	err := backoff.Retry(func() error {
+//isIdempotent checks if sending the same request many times has the same effect of sending it once
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "POST", "PATCH":
+		return false
+	default:
+		return true
+	}
+}
+
+//hasHeader checks if the header is present in the map, ignoring the case
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//resolve builds the final url, prefixing the base url when the given url is not absolute
+func (c *Client) resolve(path string) string {
+	if c.baseURL == "" || strings.Contains(path, "://") {
+		return path
+	}
+	return c.baseURL + "/" + strings.TrimLeft(path, "/")
+}
+
+func (c *Client) request(ctx context.Context, method string, logger Logger, url string, obj interface{}, target interface{}, headers map[string]string) (*Response, *errors.Error) {
+	response, _, err := c.send(ctx, method, logger, url, obj, target, headers, false)
+	return response, err
+}
+
+//send sends the request, retrying it as the policy allows
+//When stream is set, the body of a successful response is not read but returned, and the caller must close it
+func (c *Client) send(ctx context.Context, method string, logger Logger, url string, obj interface{}, target interface{}, headers map[string]string, stream bool) (*Response, io.ReadCloser, *errors.Error) {
+
+	var response *Response
+	var reader io.ReadCloser
+	retry := c.retry.backOff(method)
+
+	//the request id of the context is logged and forwarded to the service called
+	logger = ContextLogger(ctx, logger)
+	if id := RequestID(ctx); id != "" && !hasHeader(headers, RequestIDHeader) {
+		copied := map[string]string{RequestIDHeader: id}
+		for key, value := range headers {
+			copied[key] = value
+		}
+		headers = copied
+	}
+
+	//a retried non-idempotent call carries the same key in all the attempts, so the server can discard the duplicates
+	if c.retry.RetryNonIdempotent && !isIdempotent(method) && c.retry.IdempotencyHeader != "" && !hasHeader(headers, c.retry.IdempotencyHeader) {
+		copied := map[string]string{c.retry.IdempotencyHeader: uuid.NewV4().String()}
+		for key, value := range headers {
+			copied[key] = value
+		}
+		headers = copied
+	}
+
+	//the body is prepared once, so all the attempts send the same payload
+	payload, err := newPayload(obj, c.codec(c.contentType(obj, headers)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempt := 0
+	e := backoff.Retry(func() error {
 
 		var e error
 		var err *errors.Error
 
+		attempt++
+
 		var resp *http.Response
 		var req *http.Request
 
-		var buffer io.Reader = bytes.NewBuffer([]byte{})
+		req, e = http.NewRequestWithContext(ctx, method, c.resolve(url), nil)
+		err = errors.WrapInner("error creating the request", e, 0)
 
-		if obj != nil {
+		if err != nil {
+			return backoff.Permanent(err)
+		}
 
-			switch obj.(type) {
-			case io.Reader:
-				//in case of it being a io.Reader, do nothing
-				buffer = obj.(io.Reader)
-			default:
-				//in case of it being any other object, try to convert
-				b := &bytes.Buffer{}
-				enc := json.NewEncoder(b)
-				enc.SetEscapeHTML(false)
+		req.ContentLength = payload.length
+		req.GetBody = payload.open
 
-				e = enc.Encode(obj)
-				err = errors.WrapInner("error marshalling", e, 0)
+		//the client headers are added first, so the headers of the call can replace them
+		for key, value := range c.headers {
+			req.Header.Set(key, value)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
 
-				if err == nil {
-					j := []byte(string(b.Bytes()))
-					buffer = bytes.NewBuffer(j)
-				}
+		//the content type given keeps its media type and parameters (as the charset), but the multipart one
+		//is always the encoded one, as it carries the boundary
+		if _, multipart := obj.(*Multipart); multipart || (req.Header.Get("Content-Type") == "" && payload.contentType != "") {
+			req.Header.Set("Content-Type", payload.contentType)
+		} else if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		//the authentication may read the body (to sign it), so it comes before opening the body
+		if c.auth != nil {
+			//the token endpoints are already retried by their own client
+			err = c.auth.Authenticate(req)
+			if err != nil {
+				return backoff.Permanent(err)
 			}
 		}
 
+		//each attempt sends the body from its beginning
+		req.Body, e = payload.open()
+		err = errors.WrapInner("error rewinding the body", e, 0)
+
 		if err != nil {
-			return err
+			return backoff.Permanent(err)
 		}
 
-		req, e = http.NewRequest(method, url, buffer)
-		err = errors.WrapInner("error creating the request", e, 0)
+		//the limits of the host may hold the call until there is a free slot and the rate allows it
+		limit := c.limiter(req.URL.Host)
+		err = limit.acquire(ctx)
 
-		hasContent := false
-		if headers != nil {
-			for key, value := range headers {
-				hasContent = hasContent || strings.EqualFold(key, "Content-Type")
-				req.Header.Add(key, value)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		//the slot of a stream is only released when its body is closed
+		held := true
+		defer func() {
+			if held {
+				limit.release()
 			}
+		}()
+
+		//the circuit breaker of the host refuses the call while it is open
+		circuit := c.breaker(req.URL.Host)
+		err = circuit.allow(logger)
+
+		if err != nil {
+			return backoff.Permanent(err)
 		}
 
-		if err == nil {
-			//only add a header if content-type wasn't added
-			if !hasContent {
-				req.Header.Set("Content-Type", "application/json")
+		start := time.Now()
+		resp, e = c.client.Do(req)
+		err = errors.WrapInner("error requesting", e, 0)
+
+		if err != nil {
+			circuit.record(logger, false)
+			c.logAttempt(logger, req, payload, nil, attempt, time.Since(start), err)
+			return err
+		}
+
+		success := resp.StatusCode >= 200 && resp.StatusCode < 300
+
+		//a successful stream is handed to the caller as it is
+		if stream && success {
+			held = false
+			reader = &streamBody{ReadCloser: resp.Body, release: limit.release}
+			response = &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+
+			circuit.record(logger, true)
+			c.logAttempt(logger, req, payload, response, attempt, time.Since(start), nil)
+			return nil
+		}
+
+		defer resp.Body.Close()
+
+		//the body of an error is only read up to a limit, as it may be huge
+		var source io.Reader = resp.Body
+		if !success && c.maxErrorBody > 0 {
+			source = io.LimitReader(resp.Body, c.maxErrorBody)
+		}
+
+		var body []byte
+		body, e = ioutil.ReadAll(source)
+		err = errors.WrapInner("error reading the response", e, 0)
+
+		if err != nil {
+			circuit.record(logger, false)
+			c.logAttempt(logger, req, payload, nil, attempt, time.Since(start), err)
+			return err
+		}
+
+		response = &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+		circuit.record(logger, resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests)
+
+		if success {
+			c.logAttempt(logger, req, payload, response, attempt, time.Since(start), nil)
+
+			//there is nothing to decode in a 204 or in an empty body
+			if target != nil && resp.StatusCode != http.StatusNoContent && len(body) > 0 {
+				e = c.decodeBody(response, target)
+				err = errors.WrapInner("error decoding", e, 0)
 			}
 
-			client := http.Client{Timeout: time.Duration(10 * time.Second)}
-			resp, e = client.Do(req)
-			err = errors.WrapInner("error requesting", e, 0)
-
-			if err == nil {
-
-				defer resp.Body.Close()
-
-				if resp.StatusCode == 200 || resp.StatusCode == 201 || resp.StatusCode == 202 {
-
-					err = nil
-					if target != nil {
-						//var response Response
-						e = json.NewDecoder(resp.Body).Decode(&target)
-						err = errors.WrapInner("error decoding", e, 0)
-					}
-					return err
-
-				} else {
-
-					scanner := bufio.NewScanner(resp.Body)
-					scanner.Split(bufio.ScanRunes)
-					var buf bytes.Buffer
-
-					for scanner.Scan() {
-						buf.WriteString(scanner.Text())
-					}
-
-					body := buf.String()
-
-					//try to decode if there is a target (suppress any error)
-					if target != nil {
-						b := strings.Replace(body, "'", "\"", -1)
-						_ = json.Unmarshal([]byte(b), &target)
-					}
-
-					//cleans up the string to print
-					pbody := strings.Replace(body, "\"", "'", -1)
-					var baseErr error
-
-					//create a base error (or a caused by)
-					if obj == nil {
-						baseErr = fmt.Errorf("error in service - %s %s -> code %d and body %s", method, url, resp.StatusCode, pbody)
-					} else {
-
-						//try to parse object
-						var ojson *string
-						var obytes []byte
-
-						//try to parse body to json
-						obytes, e = json.Marshal(obj)
-
-						if e == nil {
-							temp := string(obytes)
-							ojson = &temp
-						}
-
-						var pobj string = ""
-
-						//select the information to print
-						if ojson == nil {
-							//if it was not possible to convert body to json, print the string
-							//cleans up the string to print
-							pobj = fmt.Sprintf("%v", obj)
-						} else {
-							//otherwise print the json
-							pobj = *ojson
-						}
-
-						baseErr = fmt.Errorf("error in service - %s %s - body: %v -> code %d and body %s", method, url, pobj, resp.StatusCode, pbody)
-					}
-
-					//try to convert to error
-					type Response struct {
-						Success bool `json:"success"`
-						Code    *int `json:"code"`
-						Detail  struct {
-							Message *string `json:"message"`
-						} `json:"detail"`
-					}
-					response := Response{}
-					b := strings.Replace(body, "'", "\"", -1)
-					e = json.Unmarshal([]byte(b), &response)
-
-					//check if the error was parsed
-					if e == nil && response.Code != nil && response.Detail.Message != nil {
-						//if possible to decode the error
-						err = errors.WrapInnerWithCode(*response.Detail.Message, *response.Code, baseErr, 0)
-					} else {
-						//in case of not being able to decode the error
-						err = errors.WrapInner("error marshalling", baseErr, 0)
-					}
-
-					return err
-				}
+			//the call succeeded, so a decoding error is not retried
+			if err != nil {
+				return backoff.Permanent(err)
 			}
+			return nil
 		}
 
+		//try to decode if there is a target (suppress any error)
+		if target != nil {
+			_ = c.decodeBody(response, target)
+		}
+
+		err = c.fail(method, url, obj, response)
+
+		//cached credentials were refused, so the next call gets new ones
+		if resp.StatusCode == http.StatusUnauthorized {
+			if i, ok := c.auth.(invalidator); ok {
+				i.Invalidate()
+			}
+		}
+		c.logAttempt(logger, req, payload, response, attempt, time.Since(start), err)
+
+		//only some status codes are worth a retry, the server may also say how long to wait
+		if !c.retry.retriesStatus(resp.StatusCode) {
+			return backoff.Permanent(err)
+		}
+		retry.after = parseRetryAfter(resp.Header.Get("Retry-After"))
+
 		return err
 
-	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
+	}, backoff.WithContext(retry, ctx))
+
+	if e != nil {
+		return response, nil, errors.Wrap(e, 0)
+	}
+	return response, reader, nil
+}
+
+//contentType returns the content type used to encode the body, given in the headers of the call or of the client
+//A *Multipart is always sent as multipart/form-data
+func (c *Client) contentType(obj interface{}, headers map[string]string) string {
 
-	if err == nil {
-		return nil
+	if _, ok := obj.(*Multipart); ok {
+		return "multipart/form-data"
 	}
-	return err.(*errors.Error)
+
+	for _, h := range []map[string]string{headers, c.headers} {
+		for key, value := range h {
+			if strings.EqualFold(key, "Content-Type") {
+				return value
+			}
+		}
+	}
+
+	return "application/json"
+}
+
+//payload is the body of a request, that can be opened again in each attempt
+type payload struct {
+	length      int64
+	contentType string
+	data        []byte
+	open        func() (io.ReadCloser, error)
+}
+
+//newPayload prepares the body of a request
+//A io.ReadSeeker that is also a io.ReaderAt (as a *os.File) is read from its current offset in each attempt, so large uploads are streamed
+//Any other io.Reader (even a io.ReadSeeker) is read once into memory and the other objects are encoded by the codec
+func newPayload(obj interface{}, codec Codec) (*payload, *errors.Error) {
+
+	var e error
+	var err *errors.Error
+	var data []byte
+	var contentType string
+
+	switch o := obj.(type) {
+	case nil:
+		return &payload{open: func() (io.ReadCloser, error) { return http.NoBody, nil }}, nil
+	case io.ReadSeeker:
+		var offset, end int64
+
+		offset, e = o.Seek(0, io.SeekCurrent)
+		if e == nil {
+			end, e = o.Seek(0, io.SeekEnd)
+		}
+		err = errors.WrapInner("error seeking the body", e, 0)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//the transport may still be reading the body of the last attempt when the next one starts,
+		//so each attempt reads its own section instead of sharing the offset of the reader
+		if at, ok := o.(io.ReaderAt); ok {
+			return &payload{length: end - offset, open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(io.NewSectionReader(at, offset, end-offset)), nil
+			}}, nil
+		}
+
+		//a reader that can not be read at an offset is read once into memory, as any other io.Reader
+		_, e = o.Seek(offset, io.SeekStart)
+		if e == nil {
+			data, e = ioutil.ReadAll(o)
+		}
+		err = errors.WrapInner("error reading the body", e, 0)
+	case io.Reader:
+		data, e = ioutil.ReadAll(o)
+		err = errors.WrapInner("error reading the body", e, 0)
+	default:
+		//in case of it being any other object, try to convert
+		data, contentType, e = codec.Encode(obj)
+		err = errors.WrapInner("error marshalling", e, 0)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return newPayload(nil, codec)
+	}
+
+	return &payload{length: int64(len(data)), contentType: contentType, data: data, open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}}, nil
 }
@@ -0,0 +1,216 @@
+package golib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/felipefoliatti/errors"
+)
+
+//Authenticator adds the credentials to every attempt of a call, after the headers are set
+//The body can be read through req.GetBody, the client sets req.Body only after the authentication
+type Authenticator interface {
+	Authenticate(req *http.Request) *errors.Error
+}
+
+//invalidator is implemented by the authenticators that cache credentials, discarded when the server answers 401
+type invalidator interface {
+	Invalidate()
+}
+
+//WithAuth sets the authenticator of the client
+func WithAuth(auth Authenticator) ClientOption {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+//bearerAuth sends a static token in the Authorization header
+type bearerAuth struct {
+	token string
+}
+
+//NewBearerAuth creates an Authenticator that sends "Authorization: Bearer <token>"
+func NewBearerAuth(token string) Authenticator {
+	return &bearerAuth{token: token}
+}
+
+func (a *bearerAuth) Authenticate(req *http.Request) *errors.Error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+//basicAuth sends the user and password in the Authorization header
+type basicAuth struct {
+	user     string
+	password string
+}
+
+//NewBasicAuth creates an Authenticator that uses the http basic authentication
+func NewBasicAuth(user string, password string) Authenticator {
+	return &basicAuth{user: user, password: password}
+}
+
+func (a *basicAuth) Authenticate(req *http.Request) *errors.Error {
+	req.SetBasicAuth(a.user, a.password)
+	return nil
+}
+
+//OAuth2ClientCredentials is an Authenticator that gets a token using the OAuth2 client credentials grant
+//The token is cached and requested again a little before it expires (Skew) or when the server answers 401
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	//Params are extra parameters sent to the token endpoint (as "audience")
+	Params map[string]string
+	//Skew is how long before the expiration the token is renewed (30 seconds by default)
+	Skew time.Duration
+	//Client is the client used to call the token endpoint (a new one by default)
+	Client *Client
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+//NewOAuth2ClientCredentials creates an OAuth2ClientCredentials for the token endpoint
+func NewOAuth2ClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) *OAuth2ClientCredentials {
+	return &OAuth2ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		Skew:         30 * time.Second,
+	}
+}
+
+func (a *OAuth2ClientCredentials) Authenticate(req *http.Request) *errors.Error {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token == "" || time.Now().Add(a.Skew).After(a.expires) {
+		err := a.fetch(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+//Invalidate discards the cached token, so the next call requests a new one
+func (a *OAuth2ClientCredentials) Invalidate() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.token = ""
+}
+
+//fetch requests a new token to the token endpoint
+func (a *OAuth2ClientCredentials) fetch(req *http.Request) *errors.Error {
+
+	if a.Client == nil {
+		a.Client = NewClient()
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	for key, value := range a.Params {
+		form.Set(key, value)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	headers := map[string]string{
+		"Content-Type":  "application/x-www-form-urlencoded",
+		"Authorization": "Basic " + basicCredentials(a.ClientID, a.ClientSecret),
+		"Accept":        "application/json",
+	}
+
+	_, err := a.Client.Do(req.Context(), nil, "POST", a.TokenURL, form, &token, headers)
+	if err != nil {
+		return errors.WrapInner("error requesting the oauth2 token", err, 0)
+	}
+
+	if token.AccessToken == "" {
+		return errors.New(fmt.Sprintf("the oauth2 token endpoint %s did not return an access_token", a.TokenURL))
+	}
+
+	a.token = token.AccessToken
+	a.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	//without expiration, the token is kept for an hour
+	if token.ExpiresIn <= 0 {
+		a.expires = time.Now().Add(time.Hour)
+	}
+
+	return nil
+}
+
+//basicCredentials encodes the user and password as the basic authentication does
+func basicCredentials(user string, password string) string {
+	req := http.Request{Header: http.Header{}}
+	req.SetBasicAuth(url.QueryEscape(user), url.QueryEscape(password))
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Basic ")
+}
+
+//sigV4Auth signs the requests with the AWS Signature Version 4
+type sigV4Auth struct {
+	signer  *v4.Signer
+	service string
+	region  string
+}
+
+//NewSigV4Auth creates an Authenticator that signs the requests with the AWS Signature Version 4, as required by
+//the AWS services (as "execute-api" or "es") called through the client
+func NewSigV4Auth(creds *credentials.Credentials, service string, region string) Authenticator {
+	signer := v4.NewSigner(creds, func(s *v4.Signer) {
+		//the client sets the body itself, after the authentication
+		s.DisableRequestBodyOverwrite = true
+	})
+	return &sigV4Auth{signer: signer, service: service, region: region}
+}
+
+func (a *sigV4Auth) Authenticate(req *http.Request) *errors.Error {
+
+	//the payload hash is calculated reading the body as a stream, so large uploads are not held in memory
+	if req.GetBody != nil && req.ContentLength != 0 {
+
+		body, e := req.GetBody()
+		err := errors.WrapInner("error reading the body to sign", e, 0)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		_, e = io.Copy(hash, body)
+		body.Close()
+
+		err = errors.WrapInner("error hashing the body to sign", e, 0)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash.Sum(nil)))
+	}
+
+	_, e := a.signer.Sign(req, nil, a.service, a.region, time.Now())
+	return errors.WrapInner("error signing the request", e, 0)
+}
@@ -0,0 +1,161 @@
+package golib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+//tokenServer is a stand-in of an OAuth2 token endpoint and of an API that only accepts the last token issued
+type tokenServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	issued  int
+	expires int
+	revoked bool
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	s := &tokenServer{expires: 3600}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if r.URL.Path == "/token" {
+			user, password, _ := r.BasicAuth()
+			if user != "client" || password != "secret" || r.FormValue("grant_type") != "client_credentials" {
+				t.Errorf("unexpected token request: %s:%s %s", user, password, r.Form.Encode())
+			}
+
+			s.issued++
+			s.revoked = false
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, s.issued, s.expires)
+			return
+		}
+
+		if s.revoked || r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", s.issued) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *tokenServer) tokens() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.issued
+}
+
+func TestOAuth2TokenIsCached(t *testing.T) {
+	server := newTokenServer(t)
+	defer server.Close()
+
+	auth := NewOAuth2ClientCredentials(server.URL+"/token", "client", "secret")
+	c := NewClient(WithAuth(auth))
+
+	for call := 0; call < 3; call++ {
+		if err := c.Get(nil, server.URL+"/api", nil, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	if server.tokens() != 1 {
+		t.Errorf("expected a single token request, got %d", server.tokens())
+	}
+}
+
+func TestOAuth2TokenIsRefreshedBeforeSkew(t *testing.T) {
+	server := newTokenServer(t)
+	defer server.Close()
+
+	//the tokens expire within the skew, so each call requests another one
+	server.expires = 20
+
+	auth := NewOAuth2ClientCredentials(server.URL+"/token", "client", "secret")
+	auth.Skew = 30 * time.Second
+	c := NewClient(WithAuth(auth))
+
+	for call := 0; call < 2; call++ {
+		if err := c.Get(nil, server.URL+"/api", nil, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	if server.tokens() != 2 {
+		t.Errorf("expected a token request for each call, got %d", server.tokens())
+	}
+}
+
+func TestOAuth2TokenIsDroppedAfter401(t *testing.T) {
+	server := newTokenServer(t)
+	defer server.Close()
+
+	auth := NewOAuth2ClientCredentials(server.URL+"/token", "client", "secret")
+	c := NewClient(WithAuth(auth))
+
+	if err := c.Get(nil, server.URL+"/api", nil, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	server.mutex.Lock()
+	server.revoked = true
+	server.mutex.Unlock()
+
+	if err := c.Get(nil, server.URL+"/api", nil, nil); err == nil {
+		t.Fatal("expected the call with the revoked token to fail")
+	}
+	if err := c.Get(nil, server.URL+"/api", nil, nil); err != nil {
+		t.Fatalf("expected a new token after the 401, got %s", err.Error())
+	}
+
+	if server.tokens() != 2 {
+		t.Errorf("expected 2 token requests, got %d", server.tokens())
+	}
+}
+
+func TestSigV4SignsStreamedBody(t *testing.T) {
+
+	body := strings.Repeat("streamed body ", 1024)
+	sum := sha256.Sum256([]byte(body))
+	expected := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := ioutil.ReadAll(r.Body)
+		if string(received) != body {
+			t.Errorf("expected the whole body, got %d bytes", len(received))
+		}
+
+		if r.Header.Get("X-Amz-Content-Sha256") != expected {
+			t.Errorf("expected the payload hash %s, got %s", expected, r.Header.Get("X-Amz-Content-Sha256"))
+		}
+
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(authorization, "/us-east-1/execute-api/aws4_request") {
+			t.Errorf("expected the credential scope of AKID in us-east-1 and execute-api, got %q", authorization)
+		}
+		if !strings.Contains(authorization, "x-amz-content-sha256") || !strings.Contains(authorization, "Signature=") {
+			t.Errorf("expected the payload hash to be signed, got %q", authorization)
+		}
+	}))
+	defer server.Close()
+
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "")
+	c := NewClient(WithAuth(NewSigV4Auth(creds, "execute-api", "us-east-1")))
+
+	if err := c.Put(nil, server.URL, strings.NewReader(body), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,236 @@
+package golib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//ErrCircuitOpen is the root error of the calls refused because the circuit breaker of the host is open
+//It can be checked with errors.Is(err, ErrCircuitOpen)
+var ErrCircuitOpen = fmt.Errorf("circuit breaker is open")
+
+//BreakerState is the state of the circuit breaker of a host
+type BreakerState int
+
+const (
+	//BreakerClosed lets all the calls pass, counting the failures
+	BreakerClosed BreakerState = iota
+	//BreakerOpen refuses all the calls until the cool-down ends
+	BreakerOpen
+	//BreakerHalfOpen lets a few trial calls pass, to decide if the host recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+//BreakerSettings defines when the circuit breaker of a host opens and closes
+//Network errors, 429 and 5xx responses are failures, any other response is a success
+type BreakerSettings struct {
+	//Window is the period of the failure counting in the closed state (1 minute by default)
+	Window time.Duration
+	//MinRequests is the least number of calls in the window before the breaker can open (10 by default)
+	MinRequests int
+	//FailureRatio is the ratio of failures in the window that opens the breaker (0.5 by default)
+	FailureRatio float64
+	//CoolDown is how long the breaker stays open before letting trial calls pass (30 seconds by default)
+	CoolDown time.Duration
+	//HalfOpenRequests is the number of successful trial calls needed to close the breaker (1 by default)
+	HalfOpenRequests int
+	//OnStateChange is called on every state change, besides the log in the Logger of the call
+	OnStateChange func(host string, from BreakerState, to BreakerState)
+}
+
+//DefaultBreakerSettings returns the default settings of the circuit breaker
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		Window:           time.Minute,
+		MinRequests:      10,
+		FailureRatio:     0.5,
+		CoolDown:         30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+//WithCircuitBreaker enables a circuit breaker for each host called by the client
+func WithCircuitBreaker(settings BreakerSettings) ClientOption {
+	return func(c *Client) {
+		defaults := DefaultBreakerSettings()
+		if settings.Window <= 0 {
+			settings.Window = defaults.Window
+		}
+		if settings.MinRequests <= 0 {
+			settings.MinRequests = defaults.MinRequests
+		}
+		if settings.FailureRatio <= 0 {
+			settings.FailureRatio = defaults.FailureRatio
+		}
+		if settings.CoolDown <= 0 {
+			settings.CoolDown = defaults.CoolDown
+		}
+		if settings.HalfOpenRequests <= 0 {
+			settings.HalfOpenRequests = defaults.HalfOpenRequests
+		}
+		c.breakers = &breakers{settings: settings, hosts: map[string]*breaker{}}
+	}
+}
+
+//breaker returns the circuit breaker of the host, nil when the breaker is disabled
+func (c *Client) breaker(host string) *breaker {
+	if c.breakers == nil {
+		return nil
+	}
+	return c.breakers.get(host)
+}
+
+//BreakerState returns the state of the circuit breaker of the host (closed when the breaker is disabled)
+func (c *Client) BreakerState(host string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+	b := c.breakers.get(host)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+//breakers holds the circuit breaker of each host
+type breakers struct {
+	settings BreakerSettings
+	mutex    sync.Mutex
+	hosts    map[string]*breaker
+}
+
+func (bs *breakers) get(host string) *breaker {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+
+	b, ok := bs.hosts[host]
+	if !ok {
+		b = &breaker{host: host, settings: &bs.settings, start: time.Now()}
+		bs.hosts[host] = b
+	}
+	return b
+}
+
+//breaker is the circuit breaker of a host
+type breaker struct {
+	host     string
+	settings *BreakerSettings
+
+	mutex     sync.Mutex
+	state     BreakerState
+	start     time.Time //start of the window, in the closed state
+	opened    time.Time
+	requests  int
+	failures  int
+	trials    int //trial calls in progress, in the half-open state
+	successes int //successful trial calls, in the half-open state
+}
+
+//allow checks if a call can be sent to the host
+func (b *breaker) allow(logger Logger) *errors.Error {
+
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		if time.Since(b.start) > b.settings.Window {
+			b.start = time.Now()
+			b.requests = 0
+			b.failures = 0
+		}
+		return nil
+	case BreakerOpen:
+		if time.Since(b.opened) < b.settings.CoolDown {
+			return errors.WrapInner(fmt.Sprintf("the host %s is unavailable", b.host), ErrCircuitOpen, 1)
+		}
+		b.change(logger, BreakerHalfOpen)
+	}
+
+	//in the half-open state, only a few trial calls pass at the same time
+	if b.trials >= b.settings.HalfOpenRequests {
+		return errors.WrapInner(fmt.Sprintf("the host %s is unavailable", b.host), ErrCircuitOpen, 1)
+	}
+	b.trials++
+	return nil
+}
+
+//record registers the result of a call allowed before
+func (b *breaker) record(logger Logger, success bool) {
+
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests && float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			b.change(logger, BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		b.trials--
+		if !success {
+			b.change(logger, BreakerOpen)
+		} else if b.successes++; b.successes >= b.settings.HalfOpenRequests {
+			b.change(logger, BreakerClosed)
+		}
+	}
+}
+
+//change moves the breaker to a new state, resetting its counters
+func (b *breaker) change(logger Logger, to BreakerState) {
+
+	from := b.state
+	b.state = to
+	b.start = time.Now()
+	b.requests = 0
+	b.failures = 0
+	b.trials = 0
+	b.successes = 0
+
+	if to == BreakerOpen {
+		b.opened = time.Now()
+	}
+
+	if logger != nil {
+		level := Level(WARN)
+		if to == BreakerClosed {
+			level = INFO
+		}
+		logger.LogA(level, map[string]interface{}{
+			"message": "circuit breaker state changed",
+			"host":    b.host,
+			"from":    from.String(),
+			"to":      to.String(),
+		})
+	}
+
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.host, from, to)
+	}
+}
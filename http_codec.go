@@ -0,0 +1,329 @@
+package golib
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+//Codec encodes the request bodies and decodes the response bodies of a content type
+//Encode returns the content type of the encoded body, as some types depend on the data (as the multipart boundary)
+type Codec interface {
+	Encode(v interface{}) ([]byte, string, error)
+	Decode(data []byte, v interface{}) error
+}
+
+//WithCodec registers a codec for the given content type (as "application/xml"), replacing the default one
+func WithCodec(contentType string, codec Codec) ClientOption {
+	return func(c *Client) {
+		c.codecs[mediaType(contentType)] = codec
+	}
+}
+
+//defaultCodecs returns the codecs registered in every client
+func defaultCodecs() map[string]Codec {
+	return map[string]Codec{
+		"application/json":                  JSONCodec{},
+		"application/problem+json":          JSONCodec{},
+		"application/x-www-form-urlencoded": FormCodec{},
+		"application/xml":                   XMLCodec{},
+		"text/xml":                          XMLCodec{},
+		"multipart/form-data":               MultipartCodec{},
+		"application/x-protobuf":            ProtobufCodec{},
+		"application/protobuf":              ProtobufCodec{},
+	}
+}
+
+//codec returns the codec of the content type, falling back to json when there is none
+func (c *Client) codec(contentType string) Codec {
+	if codec, ok := c.codecs[mediaType(contentType)]; ok {
+		return codec
+	}
+	return JSONCodec{}
+}
+
+//mediaType removes the parameters (as the charset) of a content type
+func mediaType(contentType string) string {
+	if t, _, e := mime.ParseMediaType(contentType); e == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+//JSONCodec encodes and decodes application/json, without escaping html
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v interface{}) ([]byte, string, error) {
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+
+	e := enc.Encode(v)
+	return b.Bytes(), "application/json", e
+}
+
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//XMLCodec encodes and decodes application/xml
+type XMLCodec struct{}
+
+func (XMLCodec) Encode(v interface{}) ([]byte, string, error) {
+	b, e := xml.Marshal(v)
+	return b, "application/xml", e
+}
+
+func (XMLCodec) Decode(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+//FormCodec encodes and decodes application/x-www-form-urlencoded
+//It encodes url.Values, maps and structs (using the "form" tag or the field name) and decodes into url.Values or map[string]string
+type FormCodec struct{}
+
+func (FormCodec) Encode(v interface{}) ([]byte, string, error) {
+
+	values := url.Values{}
+
+	switch o := v.(type) {
+	case url.Values:
+		values = o
+	case map[string][]string:
+		values = url.Values(o)
+	case map[string]string:
+		for key, value := range o {
+			values.Set(key, value)
+		}
+	case map[string]interface{}:
+		for key, value := range o {
+			values.Set(key, fmt.Sprint(value))
+		}
+	default:
+		r := reflect.Indirect(reflect.ValueOf(v))
+		if r.Kind() != reflect.Struct {
+			return nil, "", fmt.Errorf("unable to encode %T as a form", v)
+		}
+
+		for i := 0; i < r.NumField(); i++ {
+			field := r.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			name := field.Name
+			omitempty := false
+			if tag, ok := field.Tag.Lookup("form"); ok {
+				parts := strings.Split(tag, ",")
+				if parts[0] == "-" {
+					continue
+				}
+				if parts[0] != "" {
+					name = parts[0]
+				}
+				omitempty = len(parts) > 1 && parts[1] == "omitempty"
+			}
+
+			value := reflect.Indirect(r.Field(i))
+			if !value.IsValid() || (omitempty && value.IsZero()) {
+				continue
+			}
+			values.Set(name, fmt.Sprint(value.Interface()))
+		}
+	}
+
+	return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+func (FormCodec) Decode(data []byte, v interface{}) error {
+
+	values, e := url.ParseQuery(string(data))
+	if e != nil {
+		return e
+	}
+
+	switch o := v.(type) {
+	case *url.Values:
+		*o = values
+	case *map[string]string:
+		*o = map[string]string{}
+		for key := range values {
+			(*o)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("unable to decode a form into %T", v)
+	}
+
+	return nil
+}
+
+//ProtobufCodec encodes and decodes application/x-protobuf
+//The messages must expose Marshal/Unmarshal (as the ones generated by gogo/protobuf) or implement encoding.BinaryMarshaler/BinaryUnmarshaler
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Encode(v interface{}) ([]byte, string, error) {
+	switch m := v.(type) {
+	case interface{ Marshal() ([]byte, error) }:
+		b, e := m.Marshal()
+		return b, "application/x-protobuf", e
+	case encoding.BinaryMarshaler:
+		b, e := m.MarshalBinary()
+		return b, "application/x-protobuf", e
+	}
+	return nil, "", fmt.Errorf("unable to encode %T as protobuf", v)
+}
+
+func (ProtobufCodec) Decode(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case interface{ Unmarshal([]byte) error }:
+		return m.Unmarshal(data)
+	case encoding.BinaryUnmarshaler:
+		return m.UnmarshalBinary(data)
+	}
+	return fmt.Errorf("unable to decode protobuf into %T", v)
+}
+
+//MultipartCodec encodes a *Multipart as multipart/form-data
+//Decoding multipart responses is not supported
+type MultipartCodec struct{}
+
+func (MultipartCodec) Encode(v interface{}) ([]byte, string, error) {
+	m, ok := v.(*Multipart)
+	if !ok {
+		return nil, "", fmt.Errorf("unable to encode %T as multipart, use a *Multipart", v)
+	}
+	return m.encode()
+}
+
+func (MultipartCodec) Decode(data []byte, v interface{}) error {
+	return fmt.Errorf("unable to decode multipart into %T", v)
+}
+
+//Multipart builds a multipart/form-data body, with fields and files
+//It can be sent as the obj of any call, without setting the Content-Type
+type Multipart struct {
+	parts []part
+}
+
+type part struct {
+	field       string
+	filename    string
+	contentType string
+	content     io.Reader
+	path        string
+}
+
+//NewMultipart creates an empty multipart body
+func NewMultipart() *Multipart {
+	return &Multipart{}
+}
+
+//Field adds a text field
+func (m *Multipart) Field(name string, value string) *Multipart {
+	m.parts = append(m.parts, part{field: name, content: strings.NewReader(value)})
+	return m
+}
+
+//File adds a file read from content, sent as application/octet-stream
+func (m *Multipart) File(field string, filename string, content io.Reader) *Multipart {
+	return m.FileWithType(field, filename, "application/octet-stream", content)
+}
+
+//FileWithType adds a file read from content with the given content type
+func (m *Multipart) FileWithType(field string, filename string, contentType string, content io.Reader) *Multipart {
+	m.parts = append(m.parts, part{field: field, filename: filename, contentType: contentType, content: content})
+	return m
+}
+
+//FilePath adds a file read from the disk when the body is encoded, with the content type guessed from its extension
+func (m *Multipart) FilePath(field string, path string) *Multipart {
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	m.parts = append(m.parts, part{field: field, filename: filepath.Base(path), contentType: contentType, path: path})
+	return m
+}
+
+func (m *Multipart) encode() ([]byte, string, error) {
+
+	b := &bytes.Buffer{}
+	w := multipart.NewWriter(b)
+
+	for _, p := range m.parts {
+
+		var e error
+		var dst io.Writer
+
+		if p.filename == "" {
+			dst, e = w.CreateFormField(p.field)
+		} else {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(p.field), escapeQuotes(p.filename)))
+			header.Set("Content-Type", p.contentType)
+			dst, e = w.CreatePart(header)
+		}
+
+		if e != nil {
+			return nil, "", e
+		}
+
+		content := p.content
+		if p.path != "" {
+			var f *os.File
+			if f, e = os.Open(p.path); e != nil {
+				return nil, "", e
+			}
+			defer f.Close()
+			content = f
+		}
+
+		if _, e = io.Copy(dst, content); e != nil {
+			return nil, "", e
+		}
+	}
+
+	if e := w.Close(); e != nil {
+		return nil, "", e
+	}
+
+	return b.Bytes(), w.FormDataContentType(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+//decodeBody decodes a response body into target, choosing the codec by the response content type
+//When target is a *string or *[]byte, the raw body is assigned
+func (c *Client) decodeBody(response *Response, target interface{}) error {
+
+	switch t := target.(type) {
+	case *string:
+		*t = string(response.Body)
+		return nil
+	case *[]byte:
+		*t = response.Body
+		return nil
+	}
+
+	codec := c.codec(response.Header.Get("Content-Type"))
+	if _, ok := codec.(JSONCodec); ok {
+		//keeps the original behaviour, where target may be a non-pointer holding a pointer
+		return json.Unmarshal(response.Body, &target)
+	}
+	return codec.Decode(response.Body, target)
+}
@@ -0,0 +1,136 @@
+package golib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//HTTPError is the error of a call answered with a status code other than 2xx
+//It is the inner error of the *errors.Error returned by the client, reachable through Root()
+type HTTPError struct {
+	Method      string
+	URL         string
+	RequestBody string
+	StatusCode  int
+	Code        *int
+	Message     *string
+	Header      http.Header
+	Body        []byte
+}
+
+func (e *HTTPError) Error() string {
+	//cleans up the string to print
+	body := strings.Replace(string(e.Body), "\"", "'", -1)
+
+	if e.RequestBody == "" {
+		return fmt.Sprintf("error in service - %s %s -> code %d and body %s", e.Method, e.URL, e.StatusCode, body)
+	}
+	return fmt.Sprintf("error in service - %s %s - body: %v -> code %d and body %s", e.Method, e.URL, e.RequestBody, e.StatusCode, body)
+}
+
+//ErrorDecoder reads the code and the message of an error from a response
+//When the body is not in the expected format, ok must be false, so the next decoder is tried
+type ErrorDecoder func(response *Response) (code int, message string, ok bool)
+
+//WithErrorDecoders replaces the error decoders of the client, tried in the given order
+//By default, EnvelopeErrorDecoder and ProblemErrorDecoder are used
+func WithErrorDecoders(decoders ...ErrorDecoder) ClientOption {
+	return func(c *Client) {
+		c.decoders = decoders
+	}
+}
+
+//EnvelopeErrorDecoder decodes the golib envelope: {"success": false, "code": 1, "detail": {"message": "..."}}
+func EnvelopeErrorDecoder(response *Response) (int, string, bool) {
+
+	type Envelope struct {
+		Success bool `json:"success"`
+		Code    *int `json:"code"`
+		Detail  struct {
+			Message *string `json:"message"`
+		} `json:"detail"`
+	}
+
+	envelope := Envelope{}
+	e := json.Unmarshal(response.Body, &envelope)
+
+	if e != nil || envelope.Code == nil || envelope.Detail.Message == nil {
+		return 0, "", false
+	}
+	return *envelope.Code, *envelope.Detail.Message, true
+}
+
+//ProblemErrorDecoder decodes the RFC 7807 problem details (application/problem+json)
+//The message is the detail (or the title) and the code is the "code" extension member, falling back to the status
+func ProblemErrorDecoder(response *Response) (int, string, bool) {
+
+	type Problem struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status *int   `json:"status"`
+		Detail string `json:"detail"`
+		Code   *int   `json:"code"`
+	}
+
+	problem := Problem{}
+	e := json.Unmarshal(response.Body, &problem)
+
+	if e != nil || (problem.Title == "" && problem.Detail == "") {
+		return 0, "", false
+	}
+
+	//without the problem content type, at least the type or status members must be present
+	if mediaType(response.Header.Get("Content-Type")) != "application/problem+json" && problem.Type == "" && problem.Status == nil {
+		return 0, "", false
+	}
+
+	code := response.StatusCode
+	if problem.Code != nil {
+		code = *problem.Code
+	} else if problem.Status != nil {
+		code = *problem.Status
+	}
+
+	message := problem.Detail
+	if message == "" {
+		message = problem.Title
+	}
+
+	return code, message, true
+}
+
+//fail creates the error of a response that was not successful
+func (c *Client) fail(method string, url string, obj interface{}, response *Response) *errors.Error {
+
+	httpErr := &HTTPError{
+		Method:     method,
+		URL:        url,
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       response.Body,
+	}
+
+	if obj != nil {
+		//select the information to print: the json when possible, otherwise the string
+		if obytes, e := json.Marshal(obj); e == nil {
+			httpErr.RequestBody = string(obytes)
+		} else {
+			httpErr.RequestBody = fmt.Sprintf("%v", obj)
+		}
+	}
+
+	for _, decoder := range c.decoders {
+		if code, message, ok := decoder(response); ok {
+			httpErr.Code = &code
+			httpErr.Message = &message
+			return errors.WrapInnerWithCode(message, code, httpErr, 1)
+		}
+	}
+
+	//in case of not being able to decode the error
+	return errors.WrapInner("error in service", httpErr, 1)
+}
@@ -0,0 +1,234 @@
+package golib
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//HostLimits are the client-side limits of the calls to a host
+type HostLimits struct {
+	//Rate is the max number of requests per second, as a token bucket (0 means no limit)
+	Rate float64
+	//Burst is the size of the bucket, the number of requests that can be sent at once (the Rate rounded up by default)
+	Burst int
+	//MaxInFlight is the max number of requests in progress at the same time (0 means no limit)
+	MaxInFlight int
+}
+
+//LimiterStats are the statistics of the limits of a host
+type LimiterStats struct {
+	//Allowed is the number of requests that were sent
+	Allowed uint64
+	//Waited is the number of requests that had to wait for the rate or for a free slot
+	Waited uint64
+	//WaitTime is the total time the requests waited
+	WaitTime time.Duration
+	//Canceled is the number of requests that gave up waiting, as their context was done
+	Canceled uint64
+	//InFlight is the number of requests in progress
+	InFlight int
+	//PeakInFlight is the max number of requests in progress at the same time
+	PeakInFlight int
+}
+
+//WithHostLimits sets the limits of the calls to the host (as "api.partner.com" or "api.partner.com:8443")
+//When host is empty, the limits apply to every host without its own limits, each host with its own bucket
+func WithHostLimits(host string, limits HostLimits) ClientOption {
+	return func(c *Client) {
+		if limits.Burst <= 0 {
+			limits.Burst = int(math.Max(1, math.Ceil(limits.Rate)))
+		}
+		if c.limiters == nil {
+			c.limiters = &limiters{limits: map[string]HostLimits{}, hosts: map[string]*limiter{}}
+		}
+		c.limiters.limits[host] = limits
+	}
+}
+
+//LimiterStats returns the statistics of the limits of each host called
+func (c *Client) LimiterStats() map[string]LimiterStats {
+
+	stats := map[string]LimiterStats{}
+	if c.limiters == nil {
+		return stats
+	}
+
+	c.limiters.mutex.Lock()
+	defer c.limiters.mutex.Unlock()
+
+	for host, l := range c.limiters.hosts {
+		l.mutex.Lock()
+		stats[host] = l.stats
+		l.mutex.Unlock()
+	}
+	return stats
+}
+
+//limiters holds the limiter of each host
+type limiters struct {
+	limits map[string]HostLimits
+	mutex  sync.Mutex
+	hosts  map[string]*limiter
+}
+
+//limiter returns the limiter of the host, nil when the host has no limits
+func (c *Client) limiter(host string) *limiter {
+
+	if c.limiters == nil {
+		return nil
+	}
+
+	ls := c.limiters
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	if l, ok := ls.hosts[host]; ok {
+		return l
+	}
+
+	limits, ok := ls.limits[host]
+	if !ok {
+		if limits, ok = ls.limits[""]; !ok {
+			return nil
+		}
+	}
+
+	l := &limiter{limits: limits, tokens: float64(limits.Burst), last: time.Now()}
+	if limits.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, limits.MaxInFlight)
+	}
+	ls.hosts[host] = l
+	return l
+}
+
+//limiter applies the limits of a host
+type limiter struct {
+	limits HostLimits
+	slots  chan struct{}
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+	stats  LimiterStats
+}
+
+//acquire waits for a free slot and for a token of the bucket, giving up when the context is done
+//When it succeeds, release must be called after the request
+func (l *limiter) acquire(ctx context.Context) *errors.Error {
+
+	if l == nil {
+		return nil
+	}
+
+	start := time.Now()
+	waited := false
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			waited = true
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				l.done(start, waited, false)
+				return errors.WrapInner("error waiting for a free slot to the host", ctx.Err(), 0)
+			}
+		}
+	}
+
+	if wait := l.reserve(); wait > 0 {
+		waited = true
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.cancel()
+			if l.slots != nil {
+				<-l.slots
+			}
+			l.done(start, waited, false)
+			return errors.WrapInner("error waiting for the rate limit of the host", ctx.Err(), 0)
+		}
+	}
+
+	l.done(start, waited, true)
+	return nil
+}
+
+//release frees the slot taken by acquire
+func (l *limiter) release() {
+
+	if l == nil {
+		return
+	}
+
+	if l.slots != nil {
+		<-l.slots
+	}
+
+	l.mutex.Lock()
+	l.stats.InFlight--
+	l.mutex.Unlock()
+}
+
+//reserve takes a token of the bucket, returning how long to wait until it is available
+func (l *limiter) reserve() time.Duration {
+
+	if l.limits.Rate <= 0 {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(float64(l.limits.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limits.Rate)
+	l.last = now
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.limits.Rate * float64(time.Second))
+}
+
+//cancel gives back the token taken by a reservation that was not used
+func (l *limiter) cancel() {
+	if l.limits.Rate <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tokens++
+}
+
+//done updates the statistics of a request that finished waiting
+func (l *limiter) done(start time.Time, waited bool, allowed bool) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if waited {
+		l.stats.Waited++
+		l.stats.WaitTime += time.Since(start)
+	}
+
+	if !allowed {
+		l.stats.Canceled++
+		return
+	}
+
+	l.stats.Allowed++
+	l.stats.InFlight++
+	if l.stats.InFlight > l.stats.PeakInFlight {
+		l.stats.PeakInFlight = l.stats.InFlight
+	}
+}
@@ -0,0 +1,225 @@
+package golib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//Middleware wraps the round tripper of the client, intercepting every attempt of the calls
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+//RoundTripperFunc is an adapter to use a function as a http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//WithMiddleware adds middlewares to the client, the first one given is the first one to see the request
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+//chain wraps the transport with the middlewares
+func chain(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+const redacted = "[REDACTED]"
+
+//HTTPLogOptions defines what the client logs of each attempt through the Logger given in the call
+type HTTPLogOptions struct {
+	//Bodies enables the logging of the request and response bodies
+	Bodies bool
+	//MaxBody is the max number of bytes of each body logged (4096 by default)
+	MaxBody int
+	//RedactHeaders are the headers whose values are not logged (case insensitive, "*" matching any characters as in "*-Token")
+	//The usual secrets (as Authorization, Cookie and the AWS tokens) are always added to them
+	RedactHeaders []string
+	//RedactFields are the json fields, form fields and query parameters whose values are not logged (as RedactHeaders)
+	//The usual secrets (as password and access_token) are always added to them
+	RedactFields []string
+	//LogSecrets stops adding the usual secrets to RedactHeaders and RedactFields, so only the ones given are redacted
+	LogSecrets bool
+}
+
+//defaultRedactHeaders and defaultRedactFields are the usual secrets, redacted unless LogSecrets is set
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+	"X-Amz-Security-Token", "*-Token", "*-Secret", "*-Signature"}
+var defaultRedactFields = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret",
+	"X-Amz-Security-Token", "X-Amz-Signature", "X-Amz-Credential"}
+
+//DefaultHTTPLogOptions returns log options that redact the usual secrets, without logging the bodies
+func DefaultHTTPLogOptions() HTTPLogOptions {
+	return HTTPLogOptions{
+		MaxBody:       4096,
+		RedactHeaders: append([]string{}, defaultRedactHeaders...),
+		RedactFields:  append([]string{}, defaultRedactFields...),
+	}
+}
+
+//WithLogging enables the logging of every attempt: method, url, status, latency, attempt number and, optionally, bodies
+//The successful attempts are logged as INFO and the failed ones as WARN
+func WithLogging(options HTTPLogOptions) ClientOption {
+	return func(c *Client) {
+		if options.MaxBody <= 0 {
+			options.MaxBody = 4096
+		}
+		if !options.LogSecrets {
+			options.RedactHeaders = mergeNames(options.RedactHeaders, defaultRedactHeaders)
+			options.RedactFields = mergeNames(options.RedactFields, defaultRedactFields)
+		}
+		c.logging = &options
+	}
+}
+
+//mergeNames adds to the names the defaults that are not there yet (ignoring the case), in a new slice
+func mergeNames(names []string, defaults []string) []string {
+
+	merged := append([]string{}, names...)
+	for _, d := range defaults {
+		found := false
+		for _, n := range names {
+			if strings.EqualFold(n, d) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+//logAttempt logs an attempt of a call, if the logging is enabled
+func (c *Client) logAttempt(logger Logger, req *http.Request, payload *payload, response *Response, attempt int, latency time.Duration, err *errors.Error) {
+
+	if c.logging == nil || logger == nil || req == nil {
+		return
+	}
+
+	o := c.logging
+	entry := map[string]interface{}{
+		"message":    "http request",
+		"method":     req.Method,
+		"url":        o.redactURL(req.URL),
+		"attempt":    attempt,
+		"latency_ms": latency.Seconds() * 1000,
+		"headers":    o.redactHeaders(req.Header),
+	}
+
+	if response != nil {
+		entry["status"] = response.StatusCode
+	}
+
+	if o.Bodies {
+		if payload.data != nil {
+			entry["request_body"] = o.redactBody(req.Header.Get("Content-Type"), payload.data)
+		}
+		if response != nil {
+			entry["response_body"] = o.redactBody(response.Header.Get("Content-Type"), response.Body)
+		}
+	}
+
+	level := Level(INFO)
+	if err != nil {
+		level = WARN
+		entry["error"] = err.Error()
+	}
+
+	logger.LogA(level, entry)
+}
+
+func (o *HTTPLogOptions) redactHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for key := range header {
+		headers[key] = header.Get(key)
+		if o.redacts(o.RedactHeaders, key) {
+			headers[key] = redacted
+		}
+	}
+	return headers
+}
+
+func (o *HTTPLogOptions) redactURL(u *url.URL) string {
+	copied := *u
+	copied.RawQuery = o.redactValues(u.Query()).Encode()
+	if copied.User != nil {
+		copied.User = url.User(copied.User.Username())
+	}
+	return copied.String()
+}
+
+func (o *HTTPLogOptions) redactValues(values url.Values) url.Values {
+	for key := range values {
+		if o.redacts(o.RedactFields, key) {
+			values[key] = []string{redacted}
+		}
+	}
+	return values
+}
+
+//redactBody hides the secret fields of a json or form body and truncates it
+func (o *HTTPLogOptions) redactBody(contentType string, body []byte) string {
+
+	switch mediaType(contentType) {
+	case "application/x-www-form-urlencoded":
+		if values, e := url.ParseQuery(string(body)); e == nil {
+			body = []byte(o.redactValues(values).Encode())
+		}
+	default:
+		var obj interface{}
+		if e := json.Unmarshal(body, &obj); e == nil {
+			if b, e := json.Marshal(o.redactJSON(obj)); e == nil {
+				body = b
+			}
+		}
+	}
+
+	if len(body) > o.MaxBody {
+		return string(body[:o.MaxBody]) + "..."
+	}
+	return string(body)
+}
+
+func (o *HTTPLogOptions) redactJSON(obj interface{}) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if o.redacts(o.RedactFields, key) {
+				v[key] = redacted
+			} else {
+				v[key] = o.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = o.redactJSON(v[i])
+		}
+	}
+	return obj
+}
+
+func (o *HTTPLogOptions) redacts(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+		if matched, _ := path.Match(strings.ToLower(n), strings.ToLower(name)); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package golib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//entriesLogger keeps the entries logged through LogA, as json
+type entriesLogger struct {
+	Logger
+	entries []string
+}
+
+func (l *entriesLogger) LogA(level Level, data interface{}) {
+	encoded, _ := json.Marshal(data)
+	l.entries = append(l.entries, string(encoded))
+}
+
+func TestLoggingRedactsSecretsByDefault(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"issued-token"}`))
+	}))
+	defer server.Close()
+
+	headers := map[string]string{
+		"Authorization":        "Bearer bearer-secret",
+		"Cookie":               "session=cookie-secret",
+		"X-Amz-Security-Token": "session-secret",
+	}
+
+	cases := []struct {
+		name    string
+		options HTTPLogOptions
+		logged  bool
+	}{
+		{"zero options", HTTPLogOptions{Bodies: true}, false},
+		{"own lists", HTTPLogOptions{Bodies: true, RedactHeaders: []string{"X-Other"}, RedactFields: []string{"other"}}, false},
+		{"log secrets", HTTPLogOptions{Bodies: true, LogSecrets: true}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			logger := &entriesLogger{}
+			client := NewClient(WithLogging(c.options))
+
+			err := client.Post(logger, server.URL+"?token=query-secret", map[string]string{"password": "body-secret"}, nil, headers)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if len(logger.entries) != 1 {
+				t.Fatalf("expected a single entry, got %d", len(logger.entries))
+			}
+
+			for _, secret := range []string{"bearer-secret", "cookie-secret", "session-secret", "query-secret", "body-secret", "issued-token"} {
+				if strings.Contains(logger.entries[0], secret) != c.logged {
+					t.Errorf("expected the secret %s to be logged: %v, got %s", secret, c.logged, logger.entries[0])
+				}
+			}
+		})
+	}
+}
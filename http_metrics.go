@@ -0,0 +1,31 @@
+package golib
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//WithMetrics records every attempt of the calls in the metrics:
+//the counter "http_client_requests" and the timer "http_client_request_duration", tagged by method, host and status
+//The status of an attempt that got no response is "error"
+func WithMetrics(metrics Metrics) ClientOption {
+	return WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			start := time.Now()
+			resp, e := next.RoundTrip(req)
+
+			status := "error"
+			if e == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			tags := map[string]string{"method": req.Method, "host": req.URL.Host, "status": status}
+
+			metrics.Counter("http_client_requests", 1, tags)
+			metrics.Timer("http_client_request_duration", time.Since(start), tags)
+
+			return resp, e
+		})
+	})
+}
@@ -0,0 +1,250 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//PageStrategy finds the url of the next page from the current url and its response
+//When there are no more pages, ok is false
+type PageStrategy interface {
+	Next(current *url.URL, response *Response) (next *url.URL, ok bool)
+}
+
+//PageStrategyFunc is an adapter to use a function as a PageStrategy
+type PageStrategyFunc func(current *url.URL, response *Response) (*url.URL, bool)
+
+func (f PageStrategyFunc) Next(current *url.URL, response *Response) (*url.URL, bool) {
+	return f(current, response)
+}
+
+//LinkPagination follows the rel="next" url of the Link header (RFC 5988), as GitHub does
+func LinkPagination() PageStrategy {
+	return PageStrategyFunc(func(current *url.URL, response *Response) (*url.URL, bool) {
+
+		for _, link := range strings.Split(strings.Join(response.Header.Values("Link"), ","), ",") {
+
+			parts := strings.Split(link, ";")
+			target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+
+			for _, param := range parts[1:] {
+				param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+				if param != `rel="next"` && param != "rel=next" {
+					continue
+				}
+
+				next, e := current.Parse(target)
+				return next, e == nil
+			}
+		}
+
+		return nil, false
+	})
+}
+
+//CursorPagination reads the cursor of the next page from a json field of the body (as "meta.next_cursor")
+//and sends it in the query parameter param. An empty or missing cursor ends the pages
+func CursorPagination(field string, param string) PageStrategy {
+	return PageStrategyFunc(func(current *url.URL, response *Response) (*url.URL, bool) {
+
+		raw, ok := jsonField(response.Body, field)
+		if !ok {
+			return nil, false
+		}
+
+		var cursor interface{}
+		if e := json.Unmarshal(raw, &cursor); e != nil || cursor == nil || cursor == "" {
+			return nil, false
+		}
+
+		return withQuery(current, param, fmt.Sprint(cursor)), true
+	})
+}
+
+//PagePagination increments the page number sent in the query parameter param, starting at 1
+//The pages end when the json array at itemsField (or the body itself, when empty) has no items
+func PagePagination(param string, itemsField string) PageStrategy {
+	return PageStrategyFunc(func(current *url.URL, response *Response) (*url.URL, bool) {
+
+		if countItems(response.Body, itemsField) == 0 {
+			return nil, false
+		}
+
+		page, e := strconv.Atoi(current.Query().Get(param))
+		if e != nil {
+			page = 1
+		}
+
+		return withQuery(current, param, strconv.Itoa(page+1)), true
+	})
+}
+
+//OffsetPagination increments the offset sent in the query parameter param by the number of items received
+//The pages end when the json array at itemsField (or the body itself, when empty) has no items
+func OffsetPagination(param string, itemsField string) PageStrategy {
+	return PageStrategyFunc(func(current *url.URL, response *Response) (*url.URL, bool) {
+
+		count := countItems(response.Body, itemsField)
+		if count == 0 {
+			return nil, false
+		}
+
+		offset, _ := strconv.Atoi(current.Query().Get(param))
+		return withQuery(current, param, strconv.Itoa(offset+count)), true
+	})
+}
+
+//Pager iterates over the pages of a paginated GET, reusing the retries and the error decoding of the client
+//
+//	pager := client.Paginate(ctx, logger, "/orders", nil, golib.LinkPagination())
+//	for pager.Next(&page) {
+//		...
+//	}
+//	if err := pager.Err(); err != nil {
+//		...
+//	}
+type Pager struct {
+	client   *Client
+	ctx      context.Context
+	logger   Logger
+	headers  map[string]string
+	strategy PageStrategy
+
+	next     *url.URL
+	response *Response
+	err      *errors.Error
+}
+
+//Paginate creates a Pager that starts at the given url
+func (c *Client) Paginate(ctx context.Context, logger Logger, path string, headers map[string]string, strategy PageStrategy) *Pager {
+
+	p := &Pager{client: c, ctx: ctx, logger: logger, headers: headers, strategy: strategy}
+
+	var e error
+	p.next, e = url.Parse(c.resolve(path))
+	p.err = errors.WrapInner("error parsing the url", e, 0)
+
+	return p
+}
+
+//Paginate creates a Pager with the default client
+func Paginate(ctx context.Context, logger Logger, path string, headers map[string]string, strategy PageStrategy) *Pager {
+	return defaultClient.Paginate(ctx, logger, path, headers, strategy)
+}
+
+//Next fetches the next page and decodes it into target (that can be nil)
+//It returns false when there are no more pages or when an error happens, reported by Err
+func (p *Pager) Next(target interface{}) bool {
+
+	if p.err != nil || p.next == nil {
+		return false
+	}
+
+	current := p.next
+	p.response, p.err = p.client.request(p.ctx, http.MethodGet, p.logger, current.String(), nil, target, p.headers)
+
+	if p.err != nil {
+		return false
+	}
+
+	p.next = nil
+	if next, ok := p.strategy.Next(current, p.response); ok && next.String() != current.String() {
+		p.next = next
+	}
+
+	return true
+}
+
+//Each calls fn with each item of the json array at itemsField (or the page itself, when empty) of all the pages
+//It stops when fn returns an error, that is returned
+func (p *Pager) Each(itemsField string, fn func(item json.RawMessage) *errors.Error) *errors.Error {
+
+	for p.Next(nil) {
+
+		raw, ok := jsonField(p.response.Body, itemsField)
+		if !ok {
+			continue
+		}
+
+		var items []json.RawMessage
+		e := json.Unmarshal(raw, &items)
+		err := errors.WrapInner("error decoding the items of the page", e, 0)
+
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.err
+}
+
+//Response returns the response of the last page fetched
+func (p *Pager) Response() *Response {
+	return p.response
+}
+
+//Err returns the error that stopped the pages, if any
+func (p *Pager) Err() *errors.Error {
+	return p.err
+}
+
+//jsonField finds a field of a json body by its path (as "meta.cursor"), the body itself when the path is empty
+func jsonField(body []byte, path string) (json.RawMessage, bool) {
+
+	raw := json.RawMessage(bytes.TrimSpace(body))
+	if path == "" {
+		return raw, len(raw) > 0
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if e := json.Unmarshal(raw, &obj); e != nil {
+			return nil, false
+		}
+
+		var ok bool
+		if raw, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+
+	return raw, true
+}
+
+//countItems counts the items of the json array at the path
+func countItems(body []byte, path string) int {
+
+	raw, ok := jsonField(body, path)
+	if !ok {
+		return 0
+	}
+
+	var items []json.RawMessage
+	if e := json.Unmarshal(raw, &items); e != nil {
+		return 0
+	}
+	return len(items)
+}
+
+//withQuery copies the url, setting a query parameter
+func withQuery(u *url.URL, param string, value string) *url.URL {
+	copied := *u
+	query := copied.Query()
+	query.Set(param, value)
+	copied.RawQuery = query.Encode()
+	return &copied
+}
@@ -0,0 +1,124 @@
+package golib
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/backoff"
+)
+
+//RetryPolicy defines when a failed call is sent again
+//Only network errors and the given status codes are retried, and non-idempotent methods (POST, PATCH)
+//are only retried when RetryNonIdempotent is set - in this case, an idempotency key header is sent
+type RetryPolicy struct {
+	//MaxRetries is the number of retries after the first attempt (0 disables the retries)
+	MaxRetries uint64
+	//MaxElapsedTime stops the retries when the time since the first attempt exceeds it (0 never stops)
+	MaxElapsedTime time.Duration
+	//Statuses are the response status codes that are retried
+	Statuses []int
+	//RetryNonIdempotent enables the retries of POST and PATCH
+	RetryNonIdempotent bool
+	//IdempotencyHeader is the header sent with a generated key when a non-idempotent call may be retried
+	//If the header is already given in the call, its value is kept. Empty means no header is sent
+	IdempotencyHeader string
+}
+
+//DefaultRetryPolicy returns the policy used by the clients when none is given
+//It retries 3 times network errors, 429, 502, 503 and 504 of idempotent methods, for at most 2 minutes
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:        3,
+		MaxElapsedTime:    2 * time.Minute,
+		Statuses:          []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		IdempotencyHeader: "Idempotency-Key",
+	}
+}
+
+//WithRetryPolicy sets the retry policy of the client
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+//retries checks if the calls with the given method can be retried
+func (p RetryPolicy) retries(method string) bool {
+	return isIdempotent(method) || p.RetryNonIdempotent
+}
+
+//retriesStatus checks if a response with the given status code can be retried
+func (p RetryPolicy) retriesStatus(status int) bool {
+	for _, s := range p.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+//backOff creates the backoff used by one call
+func (p RetryPolicy) backOff(method string) *retryBackOff {
+
+	var b backoff.BackOff = &backoff.StopBackOff{}
+
+	if p.MaxRetries > 0 && p.retries(method) {
+		exp := backoff.NewExponentialBackOff()
+		exp.MaxElapsedTime = p.MaxElapsedTime
+		b = backoff.WithMaxRetries(exp, p.MaxRetries)
+	}
+
+	return &retryBackOff{delegate: b, max: p.MaxElapsedTime}
+}
+
+//retryBackOff wraps a backoff, replacing the next wait by the one the server asked in Retry-After
+type retryBackOff struct {
+	delegate backoff.BackOff
+	max      time.Duration
+	start    time.Time
+	after    time.Duration
+}
+
+func (b *retryBackOff) Reset() {
+	b.start = time.Now()
+	b.after = 0
+	b.delegate.Reset()
+}
+
+func (b *retryBackOff) NextBackOff() time.Duration {
+
+	next := b.delegate.NextBackOff()
+	if next == backoff.Stop || b.after <= 0 {
+		return next
+	}
+
+	next = b.after
+	b.after = 0
+
+	//if the server asks to wait more than the remaining time, gives up
+	if b.max > 0 && time.Since(b.start)+next > b.max {
+		return backoff.Stop
+	}
+	return next
+}
+
+//parseRetryAfter reads the Retry-After header, that can be either a number of seconds or a http date
+func parseRetryAfter(value string) time.Duration {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, e := strconv.Atoi(value); e == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, e := http.ParseTime(value); e == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
@@ -0,0 +1,202 @@
+package golib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/felipefoliatti/backoff"
+	"github.com/felipefoliatti/errors"
+)
+
+//WithMaxErrorBody sets the max number of bytes read from the body of an error response (64KB by default, 0 means no limit)
+func WithMaxErrorBody(max int64) ClientOption {
+	return func(c *Client) {
+		c.maxErrorBody = max
+	}
+}
+
+//streamBody is the body of a stream, that releases the limits of the host when closed
+type streamBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *streamBody) Close() error {
+	e := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return e
+}
+
+//Stream sends a request and returns the body of the response without reading it, so large responses are not held in memory
+//Only the connection is retried, and the caller must close the body. The Response carries the status code and the headers
+func (c *Client) Stream(ctx context.Context, logger Logger, method string, url string, obj interface{}, headers map[string]string) (*Response, io.ReadCloser, *errors.Error) {
+	return c.send(ctx, method, logger, url, obj, nil, headers, true)
+}
+
+//Stream sends a request with the default client and returns the body of the response without reading it
+func Stream(ctx context.Context, logger Logger, method string, url string, obj interface{}, headers map[string]string) (*Response, io.ReadCloser, *errors.Error) {
+	return defaultClient.Stream(ctx, logger, method, url, obj, headers)
+}
+
+//Progress is called as a download is written, with the bytes written so far and the total size (-1 when unknown)
+type Progress func(written int64, total int64)
+
+//progressWriter counts the bytes written, reporting them to a Progress
+type progressWriter struct {
+	writer   io.Writer
+	written  int64
+	total    int64
+	progress Progress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, e := w.writer.Write(p)
+	w.written += int64(n)
+	if w.progress != nil {
+		w.progress(w.written, w.total)
+	}
+	return n, e
+}
+
+//Download sends a GET and copies the body of the response into w, calling progress (that can be nil) as it is written
+func (c *Client) Download(ctx context.Context, logger Logger, url string, w io.Writer, headers map[string]string, progress Progress) (*Response, *errors.Error) {
+
+	response, body, err := c.Stream(ctx, logger, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return response, err
+	}
+	defer body.Close()
+
+	pw := &progressWriter{writer: w, total: contentLength(response), progress: progress}
+	_, e := io.Copy(pw, body)
+
+	return response, errors.WrapInner("error downloading the body", e, 0)
+}
+
+//Download sends a GET with the default client and copies the body of the response into w
+func Download(ctx context.Context, logger Logger, url string, w io.Writer, headers map[string]string, progress Progress) (*Response, *errors.Error) {
+	return defaultClient.Download(ctx, logger, url, w, headers, progress)
+}
+
+//DownloadFile downloads the url into the file at path, resuming it with a Range request when the file already has content
+//When the download breaks, it is resumed from where it stopped, as many times as the retry policy allows
+//If the server does not support ranges, the file is written again from its beginning
+func (c *Client) DownloadFile(ctx context.Context, logger Logger, url string, path string, headers map[string]string, progress Progress) *errors.Error {
+
+	f, e := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	err := errors.WrapInner("error opening the file to download", e, 0)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := c.retry.backOff(http.MethodGet)
+	e = backoff.Retry(func() error {
+		err := c.resume(ctx, logger, url, f, headers, progress)
+
+		if err == nil {
+			return nil
+		}
+
+		//an http error was already retried by the request
+		if _, ok := err.Root().(*HTTPError); ok {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(b, ctx))
+
+	return errors.Wrap(e, 0)
+}
+
+//DownloadFile downloads the url into the file at path with the default client, resuming it when the file already has content
+func DownloadFile(ctx context.Context, logger Logger, url string, path string, headers map[string]string, progress Progress) *errors.Error {
+	return defaultClient.DownloadFile(ctx, logger, url, path, headers, progress)
+}
+
+//resume downloads the rest of the file, starting at its current size
+func (c *Client) resume(ctx context.Context, logger Logger, url string, f *os.File, headers map[string]string, progress Progress) *errors.Error {
+
+	info, e := f.Stat()
+	err := errors.WrapInner("error reading the size of the file", e, 0)
+
+	if err != nil {
+		return err
+	}
+
+	offset := info.Size()
+	copied := map[string]string{}
+	for key, value := range headers {
+		copied[key] = value
+	}
+	if offset > 0 {
+		copied["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	response, body, err := c.Stream(ctx, logger, http.MethodGet, url, nil, copied)
+
+	if err != nil {
+		//the file is already complete
+		if httpErr, ok := err.Root().(*HTTPError); ok && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+
+	total := contentLength(response)
+
+	//without the range, the whole file is sent again
+	if response.StatusCode != http.StatusPartialContent {
+		offset = 0
+		e = f.Truncate(0)
+	} else if size := rangeSize(response.Header.Get("Content-Range")); size > 0 {
+		total = size
+	} else if total >= 0 {
+		total += offset
+	}
+
+	if e == nil {
+		_, e = f.Seek(offset, io.SeekStart)
+	}
+	err = errors.WrapInner("error preparing the file to download", e, 0)
+
+	if err != nil {
+		return err
+	}
+
+	pw := &progressWriter{writer: f, written: offset, total: total, progress: progress}
+	_, e = io.Copy(pw, body)
+
+	return errors.WrapInner("error downloading the body", e, 0)
+}
+
+//contentLength reads the Content-Length of the response, -1 when unknown
+func contentLength(response *Response) int64 {
+	length, e := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	if e != nil {
+		return -1
+	}
+	return length
+}
+
+//rangeSize reads the complete size of a Content-Range header (as "bytes 100-199/200"), -1 when unknown
+func rangeSize(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+
+	size, e := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if e != nil {
+		return -1
+	}
+	return size
+}
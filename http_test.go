@@ -0,0 +1,187 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//flakyServer answers 503 to the first request and 200 to the others, keeping the bodies received
+type flakyServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	bodies []string
+}
+
+func newFlakyServer(t *testing.T) *flakyServer {
+	s := &flakyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, e := ioutil.ReadAll(r.Body)
+		if e != nil {
+			t.Errorf("error reading the body: %s", e)
+		}
+		if r.ContentLength != int64(len(body)) {
+			t.Errorf("expected a Content-Length of %d, got %d", len(body), r.ContentLength)
+		}
+
+		s.mutex.Lock()
+		s.bodies = append(s.bodies, string(body))
+		first := len(s.bodies) == 1
+		s.mutex.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *flakyServer) assertBodies(t *testing.T, expected string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.bodies) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(s.bodies))
+	}
+	for attempt, body := range s.bodies {
+		if body != expected {
+			t.Errorf("attempt %d sent %q, expected %q", attempt+1, body, expected)
+		}
+	}
+}
+
+func TestRetrySendsTheSameBuffer(t *testing.T) {
+	server := newFlakyServer(t)
+	defer server.Close()
+
+	err := NewClient().Put(nil, server.URL, bytes.NewBufferString("the buffer body"), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	server.assertBodies(t, "the buffer body")
+}
+
+func TestRetrySendsTheFileFromItsOffset(t *testing.T) {
+	server := newFlakyServer(t)
+	defer server.Close()
+
+	f, e := ioutil.TempFile("", "payload")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, e = f.WriteString("skipped|the file body"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = f.Seek(int64(len("skipped|")), 0); e != nil {
+		t.Fatal(e)
+	}
+
+	err := NewClient().Put(nil, server.URL, f, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	server.assertBodies(t, "the file body")
+}
+
+//seekerOnly hides the io.ReaderAt of a reader, as the readers that can only be rewound
+type seekerOnly struct {
+	io.ReadSeeker
+}
+
+func TestRetrySendsTheSameSeekerFromItsOffset(t *testing.T) {
+	server := newFlakyServer(t)
+	defer server.Close()
+
+	reader := strings.NewReader("skipped|the seeker body")
+	reader.Seek(int64(len("skipped|")), io.SeekStart)
+
+	err := NewClient().Put(nil, server.URL, seekerOnly{reader}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	server.assertBodies(t, "the seeker body")
+}
+
+func TestRetrySendsTheSameEncodedStruct(t *testing.T) {
+	server := newFlakyServer(t)
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.RetryNonIdempotent = true
+
+	body := struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}{"golib", 2}
+
+	err := NewClient(WithRetryPolicy(policy)).Post(nil, server.URL, body, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	server.assertBodies(t, "{\"name\":\"golib\",\"count\":2}\n")
+}
+
+func TestContentTypeOfTheCallIsKept(t *testing.T) {
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	body := map[string]string{"name": "golib"}
+	c := NewClient()
+
+	c.Patch(nil, server.URL, body, nil, map[string]string{"Content-Type": "application/merge-patch+json"})
+	c.Post(nil, server.URL, body, nil, map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"})
+	c.Post(nil, server.URL, body, nil, nil)
+
+	expected := []string{"application/merge-patch+json", "application/x-www-form-urlencoded; charset=utf-8", "application/json"}
+	if len(received) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(received))
+	}
+	for r := range expected {
+		if received[r] != expected[r] {
+			t.Errorf("expected the Content-Type %q, got %q", expected[r], received[r])
+		}
+	}
+}
+
+func TestDownloadFileSucceedsAndHonoursTheContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("the file"))
+	}))
+	defer server.Close()
+
+	dir, e := ioutil.TempDir("", "download")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	//a successful download returns a nil error, not a typed nil
+	if err := NewClient().DownloadFile(context.Background(), nil, server.URL, filepath.Join(dir, "ok"), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	//a cancelled context is returned as an error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := NewClient().DownloadFile(ctx, nil, server.URL, filepath.Join(dir, "cancelled"), nil, nil); err == nil {
+		t.Fatal("expected the cancelled download to fail")
+	}
+}
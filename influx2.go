@@ -0,0 +1,214 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+//Influx2 writes to InfluxDB 2.x, sending line protocol to /api/v2/write with token authentication
+//The queries are written in Flux. It is a MetricsWriter, as the 1.x Influx
+type Influx2 struct {
+	org    string
+	bucket string
+	//precision is the name of the 1.x client, that formats the points, and wirePrecision the name of the 2.x API ("u" is "us")
+	precision     string
+	wirePrecision string
+	client        *Client
+}
+
+//NewInflux2 creates the connection to InfluxDB 2.x at the url (as "https://influx.local:8086")
+//From the options, only TLS, InsecureSkipVerify, Timeout, UserAgent and Precision are used, as the token replaces the credentials
+//It fails when the precision is not one of the 2.x ones: "ns", "u" (or "us"), "ms" and "s"
+func NewInflux2(addr string, org string, bucket string, token string, options InfluxOptions) (*Influx2, *errors.Error) {
+
+	precision, err := influxPrecision(options.Precision)
+	if err != nil {
+		return nil, err
+	}
+
+	wirePrecision := map[string]string{"ns": "ns", "u": "us", "ms": "ms", "s": "s"}[precision]
+	if wirePrecision == "" {
+		return nil, errors.New(fmt.Sprintf("invalid influx precision %q, influx 2.x only accepts ns, u (or us), ms and s", options.Precision))
+	}
+
+	headers := map[string]string{"Authorization": "Token " + token}
+	if options.UserAgent != "" {
+		headers["User-Agent"] = options.UserAgent
+	}
+
+	//the writes of the same points are idempotent, so they can be retried as any other call
+	retry := DefaultRetryPolicy()
+	retry.RetryNonIdempotent = true
+	retry.IdempotencyHeader = ""
+
+	clientOptions := []ClientOption{
+		WithBaseURL(influxAddress(addr, "", options)),
+		WithHeaders(headers),
+		WithRetryPolicy(retry),
+		WithErrorDecoders(Influx2ErrorDecoder),
+	}
+
+	config := options.TLS
+	if options.InsecureSkipVerify {
+		if config == nil {
+			config = &tls.Config{}
+		} else {
+			config = config.Clone()
+		}
+		config.InsecureSkipVerify = true
+	}
+	if config != nil {
+		clientOptions = append(clientOptions, WithTLSConfig(config))
+	}
+	if options.Timeout > 0 {
+		clientOptions = append(clientOptions, WithTimeout(options.Timeout))
+	}
+
+	return &Influx2{org: org, bucket: bucket, precision: precision, wirePrecision: wirePrecision, client: NewClient(clientOptions...)}, nil
+}
+
+//Influx2ErrorDecoder decodes the errors of InfluxDB 2.x: {"code": "invalid", "message": "..."}
+//The code of the error is the status code of the response, as the InfluxDB codes are not numbers
+func Influx2ErrorDecoder(response *Response) (int, string, bool) {
+
+	type Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	body := Error{}
+	e := json.Unmarshal(response.Body, &body)
+
+	if e != nil || body.Message == "" {
+		return 0, "", false
+	}
+	return response.StatusCode, body.Message, true
+}
+
+//Write writes a single point
+func (i *Influx2) Write(measurement string, fields map[string]interface{}, tags map[string]string, t time.Time) *errors.Error {
+
+	pt, e := v2.NewPoint(measurement, tags, fields, t)
+	err := errors.WrapInner("error creating a new point", e, 0)
+
+	if err != nil {
+		return err
+	}
+
+	return i.WritePoints([]*v2.Point{pt})
+}
+
+//WritePoints writes the points in a single request
+func (i *Influx2) WritePoints(points []*v2.Point) *errors.Error {
+	return i.WritePointsContext(context.Background(), points)
+}
+
+//WritePointsContext writes the points in a single request, giving up when the context is done
+func (i *Influx2) WritePointsContext(ctx context.Context, points []*v2.Point) *errors.Error {
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, pt := range points {
+		body.WriteString(pt.PrecisionString(i.precision))
+		body.WriteByte('\n')
+	}
+
+	query := url.Values{}
+	query.Set("org", i.org)
+	query.Set("bucket", i.bucket)
+	query.Set("precision", i.wirePrecision)
+
+	_, err := i.client.Do(ctx, nil, http.MethodPost, "/api/v2/write?"+query.Encode(), bytes.NewReader(body.Bytes()), nil, map[string]string{
+		"Content-Type": "text/plain; charset=utf-8",
+	})
+	return influxError("error writing the points to influx", err)
+}
+
+//FluxRecord is a row of the result of a Flux query, by the name of its columns (as "_time", "_field" and "_value")
+type FluxRecord map[string]string
+
+//Query runs a Flux query, returning the rows of all the tables of the result
+func (i *Influx2) Query(ctx context.Context, flux string) ([]FluxRecord, *errors.Error) {
+
+	query := url.Values{}
+	query.Set("org", i.org)
+
+	request := map[string]interface{}{
+		"query": flux,
+		"type":  "flux",
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{},
+		},
+	}
+
+	var body []byte
+	_, err := i.client.Do(ctx, nil, http.MethodPost, "/api/v2/query?"+query.Encode(), request, &body, map[string]string{
+		"Accept": "application/csv",
+	})
+	if err != nil {
+		return nil, influxError("error querying the influx database", err)
+	}
+
+	records, e := parseFluxCSV(body)
+	return records, errors.WrapInner("error reading the result of the query", e, 0)
+}
+
+//Ping checks if the server is healthy through /health
+func (i *Influx2) Ping(ctx context.Context) *errors.Error {
+	_, err := i.client.Do(ctx, nil, http.MethodGet, "/health", nil, nil, nil)
+	return influxError("error pinging the influx database", err)
+}
+
+//parseFluxCSV reads the csv of a Flux result, where each table starts with its own header
+//The first column of the csv is the annotation column, that is skipped, as the annotation rows (#datatype, #group and #default)
+func parseFluxCSV(body []byte) ([]FluxRecord, error) {
+
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+
+	records := []FluxRecord{}
+	var header []string
+
+	for {
+		row, e := reader.Read()
+		if e == io.EOF {
+			return records, nil
+		}
+		if e != nil {
+			return records, e
+		}
+
+		if strings.HasPrefix(row[0], "#") {
+			continue
+		}
+		if len(row) > 2 && row[1] == "result" && row[2] == "table" {
+			header = row
+			continue
+		}
+		if header == nil || strings.Join(row, "") == "" {
+			continue
+		}
+
+		record := FluxRecord{}
+		for c := 1; c < len(row) && c < len(header); c++ {
+			record[header[c]] = row[c]
+		}
+		records = append(records, record)
+	}
+}
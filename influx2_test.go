@@ -0,0 +1,148 @@
+package golib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestInflux2WritePoints(t *testing.T) {
+
+	cases := []struct {
+		precision string
+		query     string
+		timestamp string
+	}{
+		{"s", "s", "1600000000"},
+		{"us", "us", "1600000000123456"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.precision, func(t *testing.T) {
+
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2/write" {
+					t.Errorf("unexpected path %s", r.URL.Path)
+				}
+
+				query := r.URL.Query()
+				if query.Get("org") != "acme" || query.Get("bucket") != "metrics" || query.Get("precision") != c.query {
+					t.Errorf("unexpected query string %s", r.URL.RawQuery)
+				}
+				if r.Header.Get("Authorization") != "Token secret-token" {
+					t.Errorf("unexpected Authorization %q", r.Header.Get("Authorization"))
+				}
+
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			options := DefaultInfluxOptions()
+			options.Precision = c.precision
+			influx, err := NewInflux2(server.URL, "acme", "metrics", "secret-token", options)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			at := time.Unix(1600000000, 123456789)
+			cpu, _ := v2.NewPoint("cpu", map[string]string{"host": "a"}, map[string]interface{}{"value": 0.5}, at)
+			mem, _ := v2.NewPoint("mem", nil, map[string]interface{}{"used": 42}, at)
+
+			if err = influx.WritePoints([]*v2.Point{cpu, mem}); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			expected := "cpu,host=a value=0.5 " + c.timestamp + "\nmem used=42i " + c.timestamp + "\n"
+			if body != expected {
+				t.Errorf("expected the body %q, got %q", expected, body)
+			}
+		})
+	}
+}
+
+func TestInflux2RejectsUnsupportedPrecision(t *testing.T) {
+
+	for _, precision := range []string{"m", "h", "x"} {
+		options := DefaultInfluxOptions()
+		options.Precision = precision
+
+		if _, err := NewInflux2("http://localhost:8086", "acme", "metrics", "secret-token", options); err == nil {
+			t.Errorf("expected an error for the precision %q", precision)
+		}
+	}
+}
+
+func TestInflux2Query(t *testing.T) {
+
+	//two tables with different columns, with the annotations of each one
+	result := "#datatype,string,long,dateTime:RFC3339,double,string\r\n" +
+		"#group,false,false,false,false,true\r\n" +
+		"#default,_result,,,,\r\n" +
+		",result,table,_time,_value,_field\r\n" +
+		",,0,2020-09-13T12:26:40Z,0.5,usage\r\n" +
+		",,0,2020-09-13T12:26:50Z,0.7,usage\r\n" +
+		"\r\n" +
+		"#datatype,string,long,dateTime:RFC3339,long,string,string\r\n" +
+		"#group,false,false,false,false,true,true\r\n" +
+		"#default,_result,,,,,\r\n" +
+		",result,table,_time,_value,_field,host\r\n" +
+		",,1,2020-09-13T12:26:40Z,42,used,a\r\n" +
+		"\r\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" || r.URL.Query().Get("org") != "acme" {
+			t.Errorf("unexpected request %s", r.URL.String())
+		}
+		if r.Header.Get("Authorization") != "Token secret-token" {
+			t.Errorf("unexpected Authorization %q", r.Header.Get("Authorization"))
+		}
+
+		var request map[string]interface{}
+		if e := json.NewDecoder(r.Body).Decode(&request); e != nil || request["query"] != `from(bucket: "metrics")` || request["type"] != "flux" {
+			t.Errorf("unexpected query %v (%v)", request, e)
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Write([]byte(result))
+	}))
+	defer server.Close()
+
+	influx, err := NewInflux2(server.URL, "acme", "metrics", "secret-token", DefaultInfluxOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	records, err := influx.Query(context.Background(), `from(bucket: "metrics")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	expected := []FluxRecord{
+		{"result": "", "table": "0", "_time": "2020-09-13T12:26:40Z", "_value": "0.5", "_field": "usage"},
+		{"result": "", "table": "0", "_time": "2020-09-13T12:26:50Z", "_value": "0.7", "_field": "usage"},
+		{"result": "", "table": "1", "_time": "2020-09-13T12:26:40Z", "_value": "42", "_field": "used", "host": "a"},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %v", len(expected), len(records), records)
+	}
+	for r := range expected {
+		for column, value := range expected[r] {
+			if records[r][column] != value {
+				t.Errorf("record %d: expected %s=%q, got %q", r, column, value, records[r][column])
+			}
+		}
+		if len(records[r]) != len(expected[r]) {
+			t.Errorf("record %d: expected the columns %v, got %v", r, expected[r], records[r])
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package golib
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+//ErrBufferFull is the root error of the points dropped because the buffer of the BatchWriter is full
+var ErrBufferFull = fmt.Errorf("the buffer of points is full")
+
+//ErrWriterClosed is the root error of the points written after the BatchWriter was closed
+var ErrWriterClosed = fmt.Errorf("the writer is closed")
+
+//BatchOptions defines how the points are buffered and flushed by a BatchWriter
+type BatchOptions struct {
+	//Size is the number of points that triggers a flush (5000 by default)
+	Size int
+	//Interval is the max time a point waits in the buffer before it is flushed (1 second by default)
+	Interval time.Duration
+	//Buffer is the max number of points waiting to be flushed (10 times the Size by default)
+	Buffer int
+	//Drop makes Write drop the point when the buffer is full, instead of blocking until there is room
+	Drop bool
+	//Logger logs the failed flushes (can be nil)
+	Logger Logger
+}
+
+//DefaultBatchOptions returns the default options of a BatchWriter
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{Size: 5000, Interval: time.Second, Buffer: 50000}
+}
+
+//BatchStats are the statistics of a BatchWriter
+type BatchStats struct {
+	//Written is the number of points sent to influx
+	Written uint64
+	//Dropped is the number of points dropped because the buffer was full
+	Dropped uint64
+	//Failed is the number of points lost because their flush failed after the retries
+	Failed uint64
+	//Flushes is the number of batches sent
+	Flushes uint64
+	//FailedFlushes is the number of batches that failed after the retries
+	FailedFlushes uint64
+	//Buffered is the number of points waiting to be flushed
+	Buffered int
+}
+
+//BatchWriter buffers the points in memory and writes them to a MetricsWriter (as Influx or Influx2) in batches, in background
+//A batch is flushed when it reaches the Size or when the Interval ends, and the pending points are flushed by Close
+//
+//	writer := golib.NewBatchWriter(influx, golib.DefaultBatchOptions())
+//	defer writer.Close()
+//	writer.Write("requests", fields, tags, time.Now())
+type BatchWriter struct {
+	writer  MetricsWriter
+	options BatchOptions
+
+	points  chan *v2.Point
+	flushes chan chan *errors.Error
+	stop    chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+
+	mutex  sync.RWMutex
+	closed bool
+	once   sync.Once
+	err    *errors.Error
+
+	written       uint64
+	dropped       uint64
+	failed        uint64
+	flushed       uint64
+	failedFlushes uint64
+}
+
+//NewBatchWriter creates a BatchWriter that writes to the writer, starting its background flushes
+func NewBatchWriter(writer MetricsWriter, options BatchOptions) *BatchWriter {
+
+	defaults := DefaultBatchOptions()
+	if options.Size <= 0 {
+		options.Size = defaults.Size
+	}
+	if options.Interval <= 0 {
+		options.Interval = defaults.Interval
+	}
+	if options.Buffer <= 0 {
+		options.Buffer = 10 * options.Size
+	}
+
+	w := &BatchWriter{
+		writer:  writer,
+		options: options,
+		points:  make(chan *v2.Point, options.Buffer),
+		flushes: make(chan chan *errors.Error),
+		stop:    make(chan struct{}),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+//Write adds a point to the buffer, without waiting for it to be sent
+//When the buffer is full, it blocks until there is room, or drops the point with ErrBufferFull if the Drop option is set
+func (w *BatchWriter) Write(measurement string, fields map[string]interface{}, tags map[string]string, t time.Time) *errors.Error {
+
+	pt, e := v2.NewPoint(measurement, tags, fields, t)
+	err := errors.WrapInner("error creating a new point", e, 0)
+
+	if err != nil {
+		return err
+	}
+
+	return w.add(pt)
+}
+
+//add puts a point in the buffer, applying the policy of a full buffer
+func (w *BatchWriter) add(pt *v2.Point) *errors.Error {
+
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.closed {
+		return errors.WrapInner("error writing the point", ErrWriterClosed, 0)
+	}
+
+	select {
+	case w.points <- pt:
+		return nil
+	default:
+	}
+
+	if w.options.Drop {
+		atomic.AddUint64(&w.dropped, 1)
+		return errors.WrapInner("error writing the point", ErrBufferFull, 0)
+	}
+
+	select {
+	case w.points <- pt:
+		return nil
+	case <-w.stop:
+		return errors.WrapInner("error writing the point", ErrWriterClosed, 0)
+	}
+}
+
+//Flush sends the points buffered so far, waiting for them to be written
+func (w *BatchWriter) Flush() *errors.Error {
+
+	result := make(chan *errors.Error, 1)
+
+	select {
+	case w.flushes <- result:
+		return <-result
+	case <-w.done:
+		return errors.WrapInner("error flushing the points", ErrWriterClosed, 0)
+	}
+}
+
+//Close stops the writer, flushing the pending points. The Writes blocked by a full buffer are released with ErrWriterClosed
+//It returns the error of the last flush, if any
+func (w *BatchWriter) Close() *errors.Error {
+
+	w.once.Do(func() {
+		//release the blocked writes, then wait for all the writes to leave before the last flush
+		close(w.stop)
+		w.mutex.Lock()
+		w.closed = true
+		w.mutex.Unlock()
+
+		close(w.quit)
+	})
+
+	<-w.done
+	return w.err
+}
+
+//Stats returns the statistics of the writer
+func (w *BatchWriter) Stats() BatchStats {
+	return BatchStats{
+		Written:       atomic.LoadUint64(&w.written),
+		Dropped:       atomic.LoadUint64(&w.dropped),
+		Failed:        atomic.LoadUint64(&w.failed),
+		Flushes:       atomic.LoadUint64(&w.flushed),
+		FailedFlushes: atomic.LoadUint64(&w.failedFlushes),
+		Buffered:      len(w.points),
+	}
+}
+
+//run collects the points and flushes them, until the writer is closed
+func (w *BatchWriter) run() {
+
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*v2.Point, 0, w.options.Size)
+
+	for {
+		select {
+		case pt := <-w.points:
+			batch = append(batch, pt)
+			if len(batch) >= w.options.Size {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+
+		case result := <-w.flushes:
+			var err *errors.Error
+			batch, err = w.drain(batch)
+			if e := w.flush(batch); e != nil {
+				err = e
+			}
+			result <- err
+			batch = batch[:0]
+
+		case <-w.quit:
+			batch, w.err = w.drain(batch)
+			if err := w.flush(batch); err != nil {
+				w.err = err
+			}
+			return
+		}
+	}
+}
+
+//drain moves the points of the buffer to the batch, flushing it each time it reaches the Size
+//It returns the error of the last failed flush, if any
+func (w *BatchWriter) drain(batch []*v2.Point) ([]*v2.Point, *errors.Error) {
+
+	var err *errors.Error
+	for {
+		select {
+		case pt := <-w.points:
+			batch = append(batch, pt)
+			if len(batch) >= w.options.Size {
+				if e := w.flush(batch); e != nil {
+					err = e
+				}
+				batch = batch[:0]
+			}
+		default:
+			return batch, err
+		}
+	}
+}
+
+//flush writes a batch, counting its points as written or as failed
+func (w *BatchWriter) flush(batch []*v2.Point) *errors.Error {
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.writer.WritePoints(batch)
+	atomic.AddUint64(&w.flushed, 1)
+
+	if err == nil {
+		atomic.AddUint64(&w.written, uint64(len(batch)))
+		return nil
+	}
+
+	atomic.AddUint64(&w.failedFlushes, 1)
+	atomic.AddUint64(&w.failed, uint64(len(batch)))
+
+	if w.options.Logger != nil {
+		w.options.Logger.LogA(WARN, map[string]interface{}{
+			"message": "error flushing the points to influx",
+			"points":  len(batch),
+			"error":   err.Error(),
+		})
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package golib
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//DecodeSeries decodes the rows of all the series of the results into target, a pointer to a slice of structs (or of pointers to structs)
+//The columns and the tags of a series are matched by the influx tag of the fields (as `influx:"host"`), or by their names ignoring the case
+//A field tagged `influx:"-"` is skipped, and the fields of embedded structs are matched as the fields of the struct itself
+//time.Time fields accept RFC3339 strings and epochs in nanoseconds
+func DecodeSeries(results []v2.Result, target interface{}) *errors.Error {
+
+	slice := reflect.ValueOf(target)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return errors.New(fmt.Sprintf("the target must be a pointer to a slice, not %T", target))
+	}
+	slice = slice.Elem()
+
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("the items of the target must be structs, not %s", elem))
+	}
+
+	fields := influxFields(elem)
+
+	for _, result := range results {
+		for _, serie := range result.Series {
+			for _, row := range serie.Values {
+
+				item := reflect.New(elem).Elem()
+
+				for name, value := range serie.Tags {
+					if index, ok := fields[strings.ToLower(name)]; ok {
+						if e := assignInflux(item.FieldByIndex(index), value); e != nil {
+							return errors.WrapInner(fmt.Sprintf("error decoding the tag %s", name), e, 0)
+						}
+					}
+				}
+
+				for c, column := range serie.Columns {
+					if index, ok := fields[strings.ToLower(column)]; ok && c < len(row) {
+						if e := assignInflux(item.FieldByIndex(index), row[c]); e != nil {
+							return errors.WrapInner(fmt.Sprintf("error decoding the column %s", column), e, 0)
+						}
+					}
+				}
+
+				if isPtr {
+					item = item.Addr()
+				}
+				slice.Set(reflect.Append(slice, item))
+			}
+		}
+	}
+
+	return nil
+}
+
+//influxTag reads the name and the options of the influx tag of a field, the name of the field when there is no tag
+func influxTag(field reflect.StructField) (string, []string) {
+
+	tag, ok := field.Tag.Lookup("influx")
+	if !ok {
+		return field.Name, nil
+	}
+
+	parts := strings.Split(tag, ",")
+	if parts[0] == "" {
+		parts[0] = field.Name
+	}
+	return parts[0], parts[1:]
+}
+
+//influxFields maps the lower case names of the fields of a struct to their indexes, flattening the embedded structs
+func influxFields(t reflect.Type) map[string][]int {
+
+	fields := map[string][]int{}
+
+	for f := 0; f < t.NumField(); f++ {
+		field := t.Field(f)
+		name, _ := influxTag(field)
+
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			for inner, index := range influxFields(field.Type) {
+				if _, ok := fields[inner]; !ok {
+					fields[inner] = append([]int{f}, index...)
+				}
+			}
+			continue
+		}
+
+		fields[strings.ToLower(name)] = []int{f}
+	}
+
+	return fields
+}
+
+//assignInflux sets a field with a value of a query result (a string, a bool or a json.Number)
+func assignInflux(field reflect.Value, value interface{}) error {
+
+	if value == nil {
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if e := assignInflux(ptr.Elem(), value); e != nil {
+			return e
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		t, e := parseInfluxTime(value)
+		if e == nil {
+			field.Set(reflect.ValueOf(t))
+		}
+		return e
+	}
+
+	text := fmt.Sprint(value)
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		b, e := strconv.ParseBool(text)
+		if e != nil {
+			return e
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, e := strconv.ParseInt(text, 10, 64)
+		if e != nil {
+			//the floats of the aggregations (as MEAN) are truncated
+			f, ef := strconv.ParseFloat(text, 64)
+			if ef != nil {
+				return e
+			}
+			n = int64(f)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, e := strconv.ParseUint(text, 10, 64)
+		if e != nil {
+			f, ef := strconv.ParseFloat(text, 64)
+			if ef != nil || f < 0 {
+				return e
+			}
+			n = uint64(f)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, e := strconv.ParseFloat(text, 64)
+		if e != nil {
+			return e
+		}
+		field.SetFloat(f)
+	default:
+		v := reflect.ValueOf(value)
+		if !v.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("unable to decode %T into %s", value, field.Type())
+		}
+		field.Set(v)
+	}
+
+	return nil
+}
+
+//parseInfluxTime parses a time of a query result, as a RFC3339 string or as an epoch in nanoseconds
+func parseInfluxTime(value interface{}) (time.Time, error) {
+
+	switch v := value.(type) {
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	case json.Number:
+		n, e := v.Int64()
+		if e != nil {
+			return time.Time{}, e
+		}
+		return time.Unix(0, n).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unable to decode %T into a time", value)
+	}
+}
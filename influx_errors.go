@@ -0,0 +1,93 @@
+package golib
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//The codes of the influx errors, in the Code of the *errors.Error returned by Influx and Influx2
+const (
+	//InfluxNetworkError is a failure to reach the server, as a refused connection or a timeout
+	InfluxNetworkError = 1001
+	//InfluxAuthError is a failure of the credentials or of the permissions of the user (or of the token)
+	InfluxAuthError = 1002
+	//InfluxPartialWriteError is a write where some of the points were dropped, as the ones beyond the retention policy
+	InfluxPartialWriteError = 1003
+	//InfluxFieldTypeConflictError is a write of a field with a type other than the one already stored
+	InfluxFieldTypeConflictError = 1004
+	//InfluxServerError is any other error answered by the server, as an invalid query
+	InfluxServerError = 1005
+	//InfluxRequestError is a request rejected by the server that fails again when sent again, as a point that can not be parsed
+	//or a database that does not exist
+	InfluxRequestError = 1006
+)
+
+//influxError wraps an error of influx with the code of its class
+func influxError(message string, e error) *errors.Error {
+
+	if e == nil || e == (*errors.Error)(nil) {
+		return nil
+	}
+
+	return errors.WrapInnerWithCode(message, influxCode(e), e, 1)
+}
+
+//influxCode classifies an error of the influx clients
+func influxCode(e error) int {
+
+	if err, ok := e.(*errors.Error); ok {
+		if err.Code != nil && *err.Code >= InfluxNetworkError && *err.Code <= InfluxRequestError {
+			return *err.Code
+		}
+		e = err.Root()
+	}
+
+	text := strings.ToLower(e.Error())
+
+	if httpErr, ok := e.(*HTTPError); ok {
+		text = strings.ToLower(string(httpErr.Body))
+		switch httpErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return InfluxAuthError
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+			if !strings.Contains(text, "field type conflict") && !strings.Contains(text, "partial write") {
+				return InfluxRequestError
+			}
+		}
+	} else if _, ok := e.(net.Error); ok {
+		return InfluxNetworkError
+	}
+
+	switch {
+	case strings.Contains(text, "field type conflict"):
+		return InfluxFieldTypeConflictError
+	case strings.Contains(text, "partial write") || strings.Contains(text, "beyond retention policy"):
+		return InfluxPartialWriteError
+	case strings.Contains(text, "authorization failed") || strings.Contains(text, "error authorizing") ||
+		strings.Contains(text, "unable to parse authentication credentials") || strings.Contains(text, "not authorized") ||
+		strings.Contains(text, "unauthorized"):
+		return InfluxAuthError
+	case strings.Contains(text, "unable to parse") || strings.Contains(text, "bad timestamp") ||
+		strings.Contains(text, "database not found") || strings.Contains(text, "retention policy not found") ||
+		strings.Contains(text, "request entity too large"):
+		return InfluxRequestError
+	case strings.Contains(text, "from downstream server"):
+		//a proxy in front of the server failed, as when the server is down
+		return InfluxNetworkError
+	default:
+		return InfluxServerError
+	}
+}
+
+//influxMessage checks if an error answered by influx holds the message, ignoring the case
+func influxMessage(err *errors.Error, message string) bool {
+	return strings.Contains(strings.ToLower(err.Error()), strings.ToLower(message))
+}
+
+//retriesInflux checks if a failed call to influx can succeed when sent again
+func retriesInflux(err *errors.Error) bool {
+	return err.Code == nil || *err.Code == InfluxNetworkError || *err.Code == InfluxServerError
+}
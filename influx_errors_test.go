@@ -0,0 +1,124 @@
+package golib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//newInfluxStandIn creates an Influx connected to a stand-in server, that answers the writes with the handler
+//It returns the number of writes received so far, to check the retries
+func newInfluxStandIn(t *testing.T, handler http.HandlerFunc) (*Influx, func() int32, func()) {
+
+	var writes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			atomic.AddInt32(&writes, 1)
+		}
+		handler(w, r)
+	}))
+
+	options := DefaultInfluxOptions()
+	options.SkipProvisioning = true
+
+	influx, err := NewInfluxWithOptions("metrics", server.URL, "", "", "", options)
+	if err != nil {
+		server.Close()
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	return influx, func() int32 { return atomic.LoadInt32(&writes) }, server.Close
+}
+
+func writeCPU(influx *Influx) *errors.Error {
+	return influx.Write("cpu", map[string]interface{}{"value": 0.5}, map[string]string{"host": "a"}, time.Now())
+}
+
+func TestInfluxWriteSucceeds(t *testing.T) {
+
+	influx, writes, stop := newInfluxStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer stop()
+
+	if err := writeCPU(influx); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if writes() != 1 {
+		t.Errorf("expected a single write, got %d", writes())
+	}
+}
+
+func TestInfluxWriteErrorCodes(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		code   int
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":"authorization failed"}`, InfluxAuthError},
+		{"partial write", http.StatusBadRequest, `{"error":"partial write: points beyond retention policy dropped=1"}`, InfluxPartialWriteError},
+		{"field type conflict", http.StatusBadRequest, `{"error":"partial write: field type conflict: input field \"value\" on measurement \"cpu\" is type float, already exists as type integer dropped=1"}`, InfluxFieldTypeConflictError},
+		{"unable to parse", http.StatusBadRequest, `{"error":"unable to parse 'cpu value=': missing field value"}`, InfluxRequestError},
+		{"database not found", http.StatusNotFound, `{"error":"database not found: \"metrics\""}`, InfluxRequestError},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			influx, writes, stop := newInfluxStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			})
+			defer stop()
+
+			err := writeCPU(influx)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Code == nil || *err.Code != c.code {
+				t.Fatalf("expected the code %d, got %v (%s)", c.code, err.Code, err.Error())
+			}
+			if influxCode(err) != c.code {
+				t.Errorf("expected influxCode to keep the code %d, got %d", c.code, influxCode(err))
+			}
+
+			//the points rejected by the server are not sent again
+			if retriesInflux(err) || writes() != 1 {
+				t.Errorf("expected a single write without retries, got %d", writes())
+			}
+		})
+	}
+}
+
+func TestInfluxWriteClosedConnection(t *testing.T) {
+
+	influx, writes, stop := newInfluxStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, _, e := w.(http.Hijacker).Hijack()
+		if e != nil {
+			t.Errorf("error hijacking the connection: %s", e)
+			return
+		}
+		conn.Close()
+	})
+	defer stop()
+
+	err := writeCPU(influx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err.Code == nil || *err.Code != InfluxNetworkError {
+		t.Fatalf("expected the code %d, got %v (%s)", InfluxNetworkError, err.Code, err.Error())
+	}
+
+	//a network error is retried 3 times
+	if !retriesInflux(err) || writes() != 4 {
+		t.Errorf("expected 4 writes, got %d", writes())
+	}
+}
@@ -0,0 +1,109 @@
+package golib
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+//InfluxOptions are the settings of the connection to influx, used when it is created and on every reconnection
+type InfluxOptions struct {
+	//Username and Password are the credentials of the connection ("root" and "root" by default)
+	Username string
+	Password string
+	//TLS is the tls configuration of the https connections (can be nil)
+	TLS *tls.Config
+	//InsecureSkipVerify accepts any certificate of the server, for self-signed certificates
+	InsecureSkipVerify bool
+	//Timeout is the timeout of each request (no timeout by default)
+	Timeout time.Duration
+	//UserAgent is the User-Agent header of the requests (the one of the influx client by default)
+	UserAgent string
+	//Precision is the precision of the timestamps written: "ns", "u" (or "us"), "ms", "s", "m" or "h" ("ns" by default)
+	//Influx2 does not accept "m" and "h"
+	Precision string
+	//WriteConsistency is the consistency of the writes in a cluster, as "any", "one", "quorum" or "all" (empty by default)
+	WriteConsistency string
+
+	//SkipProvisioning disables the creation of the database and of the retention policy, for users that can not manage them
+	SkipProvisioning bool
+	//Replication is the replication factor of the retention policy (1 by default)
+	Replication int
+	//ShardDuration is the shard group duration of the retention policy, as "1d" (chosen by the server when empty)
+	ShardDuration string
+	//DefaultRetention makes the retention policy the default one of the database
+	DefaultRetention bool
+	//RetentionPolicies are other retention policies of the database, as the ones of the rollups, provisioned as the main one
+	RetentionPolicies []RetentionPolicy
+	//ContinuousQueries are the continuous queries of the database, created (or created again when changed) in the provisioning
+	ContinuousQueries []ContinuousQuery
+	//PruneContinuousQueries drops the continuous queries of the database that are not in ContinuousQueries
+	PruneContinuousQueries bool
+}
+
+//DefaultInfluxOptions returns the default options of the connection to influx
+func DefaultInfluxOptions() InfluxOptions {
+	return InfluxOptions{Username: "root", Password: "root", Precision: "ns", Replication: 1}
+}
+
+//influxAddress builds the address of the server from the host and the port
+//A host without a scheme uses http, or https when a tls configuration is set
+func influxAddress(host string, port string, options InfluxOptions) string {
+
+	host = strings.TrimRight(strings.TrimSpace(host), "/")
+
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		if options.TLS != nil || options.InsecureSkipVerify {
+			host = "https://" + host
+		} else {
+			host = "http://" + host
+		}
+	}
+
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
+
+//httpConfig is the configuration of the influx client
+func (o InfluxOptions) httpConfig(addr string) v2.HTTPConfig {
+	return v2.HTTPConfig{
+		Addr:               addr,
+		Username:           o.Username,
+		Password:           o.Password,
+		UserAgent:          o.UserAgent,
+		Timeout:            o.Timeout,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		TLSConfig:          o.TLS,
+	}
+}
+
+//influxPrecision normalises the precision to the name known by the 1.x client, where the microseconds are "u"
+//Any other name would be silently written as nanoseconds, so it fails
+func influxPrecision(precision string) (string, *errors.Error) {
+	switch precision {
+	case "", "n", "ns":
+		return "ns", nil
+	case "u", "us":
+		return "u", nil
+	case "ms", "s", "m", "h":
+		return precision, nil
+	}
+	return "", errors.New(fmt.Sprintf("invalid influx precision %q, it must be ns, u (or us), ms, s, m or h", precision))
+}
+
+//influxBatch is a batch written with the precision given apart, as the 1.x client refuses "u" when the batch is created
+//but formats the timestamps only with it
+type influxBatch struct {
+	v2.BatchPoints
+	precision string
+}
+
+func (b influxBatch) Precision() string {
+	return b.precision
+}
@@ -0,0 +1,392 @@
+package golib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//retentionPolicy is the configuration of a retention policy, as shown by SHOW RETENTION POLICIES
+type retentionPolicy struct {
+	name          string
+	duration      time.Duration //0 is infinite
+	shardDuration time.Duration //0 is unknown (chosen by the server)
+	replication   int
+	isDefault     bool
+}
+
+//RetentionPolicy is a retention policy of the database
+type RetentionPolicy struct {
+	//Name is the name of the policy
+	Name string
+	//Duration is how long the points are kept, as "7d" or "INF"
+	Duration string
+	//Replication is the replication factor (the Replication of the options by default)
+	Replication int
+	//ShardDuration is the shard group duration, as "1d" (chosen by the server when empty)
+	ShardDuration string
+	//Default makes the policy the default one of the database
+	Default bool
+}
+
+//ContinuousQuery is a continuous query of the database, as the ones that downsample the points into the rollup policies
+//
+//	golib.ContinuousQuery{
+//		Name:  "cpu_1h",
+//		Query: `SELECT mean("value") AS "value" INTO "rollup_1h"."cpu" FROM "raw"."cpu" GROUP BY time(1h), *`,
+//	}
+type ContinuousQuery struct {
+	//Name is the name of the query
+	Name string
+	//Query is the SELECT ... INTO ... GROUP BY time(...) run by the query
+	Query string
+	//ResampleEvery and ResampleFor are the RESAMPLE clause, as "30m" and "2h" (none when both are empty)
+	ResampleEvery string
+	ResampleFor   string
+}
+
+//provision creates the database, then creates the retention policies or alters them to match the options,
+//and finally creates the continuous queries. All the statements are idempotent, so it can run in every start
+func (i *Influx) provision() *errors.Error {
+
+	//the durations are checked before any statement, as they are not quoted
+	policies := []RetentionPolicy{}
+	if i.retention != "" {
+		policies = append(policies, RetentionPolicy{
+			Name:          i.retention,
+			Duration:      i.duration,
+			Replication:   i.options.Replication,
+			ShardDuration: i.options.ShardDuration,
+			Default:       i.options.DefaultRetention,
+		})
+	}
+	policies = append(policies, i.options.RetentionPolicies...)
+
+	wanted := []retentionPolicy{}
+	for _, policy := range policies {
+		p, err := policy.parse(i.options.Replication)
+		if err != nil {
+			return err
+		}
+		wanted = append(wanted, p)
+	}
+
+	queries := map[string]string{}
+	for _, cq := range i.options.ContinuousQueries {
+		statement, err := cq.statement(i.database)
+		if err != nil {
+			return err
+		}
+		queries[cq.Name] = statement
+	}
+
+	_, err := i.Query("CREATE DATABASE " + quoteIdent(i.database))
+	if err != nil {
+		return err
+	}
+
+	if len(wanted) > 0 {
+		current, err := i.retentionPolicies()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range wanted {
+			if err = i.ensureRetentionPolicy(p, current); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(queries) > 0 || i.options.PruneContinuousQueries {
+		return i.ensureContinuousQueries(queries)
+	}
+	return nil
+}
+
+//parse checks the durations of the policy, that are not quoted in the statements
+func (p RetentionPolicy) parse(replication int) (retentionPolicy, *errors.Error) {
+
+	var e error
+	var err *errors.Error
+
+	parsed := retentionPolicy{name: p.Name, replication: p.Replication, isDefault: p.Default}
+	if parsed.replication <= 0 {
+		parsed.replication = replication
+	}
+
+	parsed.duration, e = parseInfluxDuration(p.Duration)
+	err = errors.WrapInner(fmt.Sprintf("invalid duration of the retention policy %s", p.Name), e, 0)
+
+	if err == nil && p.ShardDuration != "" {
+		parsed.shardDuration, e = parseInfluxDuration(p.ShardDuration)
+		err = errors.WrapInner(fmt.Sprintf("invalid shard duration of the retention policy %s", p.Name), e, 0)
+	}
+
+	return parsed, err
+}
+
+//ensureRetentionPolicy creates the retention policy when it does not exist, or alters it when its settings are different
+func (i *Influx) ensureRetentionPolicy(wanted retentionPolicy, policies map[string]retentionPolicy) *errors.Error {
+
+	var err *errors.Error
+	current, exists := policies[wanted.name]
+
+	if !exists {
+		_, err = i.Query("CREATE RETENTION POLICY " + quoteIdent(wanted.name) + " ON " + quoteIdent(i.database) + wanted.clauses())
+		return err
+	}
+
+	//a policy can only be made the default, as another policy must be made the default in its place
+	if current.duration == wanted.duration && current.replication == wanted.replication &&
+		(wanted.shardDuration == 0 || current.shardDuration == wanted.shardDuration) &&
+		(!wanted.isDefault || current.isDefault) {
+		return nil
+	}
+
+	_, err = i.Query("ALTER RETENTION POLICY " + quoteIdent(wanted.name) + " ON " + quoteIdent(i.database) + wanted.clauses())
+	return err
+}
+
+//statement builds the CREATE CONTINUOUS QUERY of the query
+func (cq ContinuousQuery) statement(database string) (string, *errors.Error) {
+
+	if cq.Name == "" || strings.TrimSpace(cq.Query) == "" {
+		return "", errors.New("the continuous queries must have a name and a query")
+	}
+
+	resample := ""
+	for _, clause := range []struct{ keyword, value string }{{"EVERY", cq.ResampleEvery}, {"FOR", cq.ResampleFor}} {
+		if clause.value == "" {
+			continue
+		}
+		d, e := parseInfluxDuration(clause.value)
+		if e != nil || d == 0 {
+			return "", errors.New(fmt.Sprintf("invalid RESAMPLE %s of the continuous query %s", clause.keyword, cq.Name))
+		}
+		resample += " " + clause.keyword + " " + formatInfluxDuration(d)
+	}
+	if resample != "" {
+		resample = " RESAMPLE" + resample
+	}
+
+	return "CREATE CONTINUOUS QUERY " + quoteIdent(cq.Name) + " ON " + quoteIdent(database) + resample + " BEGIN " + strings.TrimSpace(cq.Query) + " END", nil
+}
+
+//ensureContinuousQueries creates the queries, and creates again the ones that changed, as they can not be altered
+//Influx accepts the creation of a query identical to the stored one, and refuses a different one as already existing,
+//so only the queries that changed are dropped, and the ones dropped meanwhile by another process are tolerated
+func (i *Influx) ensureContinuousQueries(queries map[string]string) *errors.Error {
+
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, err := i.Query(queries[name])
+		if err != nil && influxMessage(err, "already exists") {
+			if err = i.dropContinuousQuery(name); err == nil {
+				_, err = i.Query(queries[name])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !i.options.PruneContinuousQueries {
+		return nil
+	}
+
+	current, err := i.continuousQueries()
+	if err != nil {
+		return err
+	}
+
+	for name := range current {
+		if _, ok := queries[name]; !ok {
+			if err = i.dropContinuousQuery(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//dropContinuousQuery drops a continuous query, that may have already been dropped by another process
+func (i *Influx) dropContinuousQuery(name string) *errors.Error {
+
+	_, err := i.Query("DROP CONTINUOUS QUERY " + quoteIdent(name) + " ON " + quoteIdent(i.database))
+	if err != nil && influxMessage(err, "not found") {
+		return nil
+	}
+	return err
+}
+
+//continuousQueries reads the statements of the continuous queries of the database, by name
+func (i *Influx) continuousQueries() (map[string]string, *errors.Error) {
+
+	results, err := i.Query("SHOW CONTINUOUS QUERIES")
+	if err != nil {
+		return nil, err
+	}
+
+	queries := map[string]string{}
+
+	//each serie holds the queries of a database
+	for _, result := range results {
+		for _, serie := range result.Series {
+			if serie.Name != i.database {
+				continue
+			}
+
+			name, query := -1, -1
+			for index, column := range serie.Columns {
+				switch column {
+				case "name":
+					name = index
+				case "query":
+					query = index
+				}
+			}
+			if name < 0 || query < 0 {
+				continue
+			}
+
+			for _, row := range serie.Values {
+				if name < len(row) && query < len(row) {
+					queries[fmt.Sprint(row[name])] = fmt.Sprint(row[query])
+				}
+			}
+		}
+	}
+
+	return queries, nil
+}
+
+//clauses builds the settings of a CREATE or ALTER RETENTION POLICY
+func (p retentionPolicy) clauses() string {
+
+	duration := "INF"
+	if p.duration > 0 {
+		duration = formatInfluxDuration(p.duration)
+	}
+
+	clauses := fmt.Sprintf(" DURATION %s REPLICATION %d", duration, p.replication)
+	if p.shardDuration > 0 {
+		clauses += " SHARD DURATION " + formatInfluxDuration(p.shardDuration)
+	}
+	if p.isDefault {
+		clauses += " DEFAULT"
+	}
+	return clauses
+}
+
+//retentionPolicies reads the retention policies of the database, by name
+func (i *Influx) retentionPolicies() (map[string]retentionPolicy, *errors.Error) {
+
+	results, err := i.Query("SHOW RETENTION POLICIES ON " + quoteIdent(i.database))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := map[string]retentionPolicy{}
+
+	for _, result := range results {
+		for _, serie := range result.Series {
+
+			columns := map[string]int{}
+			for index, column := range serie.Columns {
+				columns[column] = index
+			}
+
+			value := func(row []interface{}, column string) string {
+				if index, ok := columns[column]; ok && index < len(row) && row[index] != nil {
+					return fmt.Sprint(row[index])
+				}
+				return ""
+			}
+
+			for _, row := range serie.Values {
+				p := retentionPolicy{name: value(row, "name")}
+				p.duration, _ = time.ParseDuration(value(row, "duration"))
+				p.shardDuration, _ = time.ParseDuration(value(row, "shardGroupDuration"))
+				p.replication, _ = strconv.Atoi(value(row, "replicaN"))
+				p.isDefault = value(row, "default") == "true"
+				policies[p.name] = p
+			}
+		}
+	}
+
+	return policies, nil
+}
+
+//quoteIdent quotes an identifier (a database, a retention policy or a measurement) of a query
+func quoteIdent(name string) string {
+	name = strings.Replace(name, `\`, `\\`, -1)
+	name = strings.Replace(name, `"`, `\"`, -1)
+	return `"` + name + `"`
+}
+
+//influxDuration matches the duration literals of InfluxQL, as "7d", "1h30m" or "500ms"
+var influxDuration = regexp.MustCompile(`(\d+)(ns|us|u|µ|ms|s|m|h|d|w)`)
+
+//parseInfluxDuration parses a duration literal of InfluxQL, where "INF" (or empty) is infinite (0)
+func parseInfluxDuration(value string) (time.Duration, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "INF") {
+		return 0, nil
+	}
+
+	units := map[string]time.Duration{
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"u":  time.Microsecond,
+		"µ":  time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+	}
+
+	var total time.Duration
+	matched := 0
+
+	for _, match := range influxDuration.FindAllStringSubmatch(value, -1) {
+		n, e := strconv.ParseInt(match[1], 10, 64)
+		if e != nil {
+			return 0, e
+		}
+		total += time.Duration(n) * units[match[2]]
+		matched += len(match[0])
+	}
+
+	//anything that is not a duration would be injected in the statement
+	if matched != len(value) {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return total, nil
+}
+
+//formatInfluxDuration formats a duration as a literal of InfluxQL, in its largest exact unit (as "7d")
+func formatInfluxDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}, {"ms", time.Millisecond}, {"u", time.Microsecond}} {
+		if d%unit.size == 0 {
+			return strconv.FormatInt(int64(d/unit.size), 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(d), 10) + "ns"
+}
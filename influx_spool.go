@@ -0,0 +1,365 @@
+package golib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/felipefoliatti/backoff"
+	"github.com/felipefoliatti/errors"
+	"github.com/influxdata/influxdb1-client/models"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+//ErrSpoolFull is the root error of a batch larger than the whole size of the spool
+var ErrSpoolFull = fmt.Errorf("the batch is larger than the spool")
+
+//spoolExt is the extension of the files of the batches, in line protocol
+const spoolExt = ".lp"
+
+//Spool keeps the batches that could not be written in files of a directory, one file for each batch, named in the order they failed
+//When the size of the files exceeds the cap, the oldest batches are dropped. The files survive restarts, so the batches
+//left by a previous process are replayed too
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mutex   sync.Mutex
+	seq     uint64
+	dropped uint64
+
+	//the replays are one at a time, so a batch is never written twice
+	replaying sync.Mutex
+}
+
+//SpoolStats are the statistics of a Spool
+type SpoolStats struct {
+	//Batches is the number of batches waiting to be replayed
+	Batches int
+	//Bytes is the size of the batches waiting to be replayed
+	Bytes int64
+	//Dropped is the number of batches dropped since the spool was opened, to respect its size
+	Dropped uint64
+}
+
+//NewSpool opens the spool in the directory, creating it when needed, with at most maxBytes of batches (0 means no limit)
+func NewSpool(dir string, maxBytes int64) (*Spool, *errors.Error) {
+
+	e := os.MkdirAll(dir, 0755)
+	err := errors.WrapInner(fmt.Sprintf("error creating the spool directory %s", dir), e, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes}
+
+	//the next batches are numbered after the ones left by the last process
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if seq, e := strconv.ParseUint(strings.TrimSuffix(f.Name(), spoolExt), 10, 64); e == nil && seq > s.seq {
+			s.seq = seq
+		}
+	}
+
+	return s, nil
+}
+
+//Save stores a batch, dropping the oldest ones when the spool exceeds its size
+func (s *Spool) Save(points []*v2.Point) *errors.Error {
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	//the points without a time would be stamped by influx when replayed, so they are stamped now
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var data bytes.Buffer
+	for _, pt := range points {
+		data.WriteString(pt.PrecisionString("ns"))
+		if pt.Time().IsZero() {
+			data.WriteString(" " + now)
+		}
+		data.WriteByte('\n')
+	}
+
+	if s.maxBytes > 0 && int64(data.Len()) > s.maxBytes {
+		return errors.WrapInner("error saving the batch", ErrSpoolFull, 0)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.shrink(int64(data.Len()))
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.seq, spoolExt))
+
+	//the batch is written in a temporary file first, so a crash never leaves half a batch to be replayed
+	e := ioutil.WriteFile(name+".tmp", data.Bytes(), 0644)
+	if e == nil {
+		e = os.Rename(name+".tmp", name)
+	}
+	return errors.WrapInner("error saving the batch in the spool", e, 0)
+}
+
+//Replay writes the batches in the order they were saved, removing each one written, until the spool is empty
+//It stops at the first batch that fails because influx is unreachable, that is kept to the next replay
+//The spool is only locked to read and remove each batch, so the batches can be saved while it is replayed
+func (s *Spool) Replay(writer MetricsWriter) *errors.Error {
+
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+
+	for {
+		s.mutex.Lock()
+		files, err := s.files()
+		s.mutex.Unlock()
+
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+
+		name := filepath.Join(s.dir, files[0].Name())
+
+		data, e := ioutil.ReadFile(name)
+		if os.IsNotExist(e) {
+			//dropped by a save, to respect the size of the spool
+			continue
+		}
+		err = errors.WrapInner("error reading the batch of the spool", e, 0)
+
+		if err != nil {
+			return err
+		}
+
+		parsed, e := models.ParsePointsWithPrecision(data, time.Now(), "n")
+		if e != nil {
+			//a corrupted batch would block the others forever
+			if err = s.remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		points := make([]*v2.Point, len(parsed))
+		for p := range parsed {
+			points[p] = v2.NewPointFrom(parsed[p])
+		}
+
+		//a batch rejected by influx would be rejected again in every replay, so it is dropped
+		if err = writer.WritePoints(points); err != nil && retriesInflux(err) {
+			return err
+		}
+
+		if err = s.remove(name); err != nil {
+			return err
+		}
+	}
+}
+
+//remove removes a batch replayed, that may have already been dropped by a save
+func (s *Spool) remove(name string) *errors.Error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e := os.Remove(name)
+	if os.IsNotExist(e) {
+		return nil
+	}
+	return errors.WrapInner("error removing the batch of the spool", e, 0)
+}
+
+//pending checks if there are batches waiting to be replayed
+func (s *Spool) pending() bool {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := s.files()
+	return err != nil || len(files) > 0
+}
+
+//Stats returns the statistics of the spool
+func (s *Spool) Stats() SpoolStats {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := SpoolStats{Dropped: s.dropped}
+
+	files, _ := s.files()
+	for _, f := range files {
+		stats.Batches++
+		stats.Bytes += f.Size()
+	}
+	return stats
+}
+
+//shrink removes the oldest batches until there is room for size bytes
+func (s *Spool) shrink(size int64) *errors.Error {
+
+	if s.maxBytes <= 0 {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	total := size
+	for _, f := range files {
+		total += f.Size()
+	}
+
+	for _, f := range files {
+		if total <= s.maxBytes {
+			break
+		}
+
+		e := os.Remove(filepath.Join(s.dir, f.Name()))
+		err = errors.WrapInner("error dropping the oldest batch of the spool", e, 0)
+
+		if err != nil {
+			return err
+		}
+		total -= f.Size()
+		s.dropped++
+	}
+
+	return nil
+}
+
+//files lists the batches, the oldest first
+func (s *Spool) files() ([]os.FileInfo, *errors.Error) {
+
+	infos, e := ioutil.ReadDir(s.dir)
+	err := errors.WrapInner("error reading the spool directory", e, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), spoolExt) {
+			files = append(files, info)
+		}
+	}
+
+	//the names have the same length, so they sort in the order of the numbers
+	sort.Slice(files, func(a, b int) bool { return files[a].Name() < files[b].Name() })
+	return files, nil
+}
+
+//spooledWriter saves in a Spool the batches that another writer fails to write
+type spooledWriter struct {
+	MetricsWriter
+	spool    *Spool
+	draining int32
+}
+
+//NewSpooledWriter wraps the writer, saving in the spool the batches that fail because influx is unreachable
+//instead of losing them. The batches rejected by influx (as a field type conflict) are not saved, as they would fail again
+//While there are batches in the spool, the new ones are saved after them, and all of them are replayed in the background,
+//in the order they were saved, retrying with an exponential backoff until the spool is empty
+//
+//	spool, err := golib.NewSpool("/var/spool/metrics", 100*1024*1024)
+//	writer := golib.NewBatchWriter(golib.NewSpooledWriter(influx, spool), golib.DefaultBatchOptions())
+func NewSpooledWriter(writer MetricsWriter, spool *Spool) MetricsWriter {
+	w := &spooledWriter{MetricsWriter: writer, spool: spool}
+
+	//the batches left by a previous process are sent as soon as influx is reachable
+	if spool.pending() {
+		w.drain()
+	}
+	return w
+}
+
+func (w *spooledWriter) Write(measurement string, fields map[string]interface{}, tags map[string]string, t time.Time) *errors.Error {
+
+	pt, e := v2.NewPoint(measurement, tags, fields, t)
+	err := errors.WrapInner("error creating a new point", e, 0)
+
+	if err != nil {
+		return err
+	}
+
+	return w.WritePoints([]*v2.Point{pt})
+}
+
+func (w *spooledWriter) WritePoints(points []*v2.Point) *errors.Error {
+
+	//the batch goes after the ones waiting, so they are all written in order
+	if w.spool.pending() {
+		return w.save(points, nil)
+	}
+
+	err := w.MetricsWriter.WritePoints(points)
+
+	if err != nil && retriesInflux(err) {
+		return w.save(points, err)
+	}
+	return err
+}
+
+//save saves a batch in the spool, starting the replay of the spool
+func (w *spooledWriter) save(points []*v2.Point, cause *errors.Error) *errors.Error {
+
+	if err := w.spool.Save(points); err != nil {
+		if cause != nil {
+			return errors.WrapInner(fmt.Sprintf("error saving the batch that failed (%s)", cause.Error()), err, 0)
+		}
+		return err
+	}
+
+	w.drain()
+	return nil
+}
+
+//drain replays the spool in the background, unless it is already being replayed
+func (w *spooledWriter) drain() {
+
+	if !atomic.CompareAndSwapInt32(&w.draining, 0, 1) {
+		return
+	}
+
+	go func() {
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxElapsedTime = 0
+
+		for {
+			if w.spool.Replay(w.MetricsWriter) != nil {
+				time.Sleep(retry.NextBackOff())
+				continue
+			}
+
+			//a batch saved after the last replay, but before the flag is cleared, would wait for the next failure
+			atomic.StoreInt32(&w.draining, 0)
+			if !w.spool.pending() || !atomic.CompareAndSwapInt32(&w.draining, 0, 1) {
+				return
+			}
+			retry.Reset()
+		}
+	}()
+}
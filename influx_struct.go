@@ -0,0 +1,249 @@
+package golib
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	v2 "github.com/influxdata/influxdb1-client/v2"
+)
+
+//StructPoint builds a point from the exported fields of a struct (or of a pointer to a struct), by their influx tags:
+//
+//	type Request struct {
+//		Host     string        `influx:"host,tag"`
+//		Status   int           `influx:"status,tag"`
+//		Duration time.Duration `influx:"duration_ns"`
+//		Bytes    *int64        `influx:"bytes,omitempty"`
+//		Cache    CacheStats    `influx:"cache"` //written as cache_hits, cache_misses, ...
+//		At       time.Time     `influx:",time"`
+//	}
+//
+//The fields are influx fields unless tagged with the "tag" option, and are named by the tag or by the name of the field
+//A field tagged `influx:"-"` is skipped, as the nil pointers and, with the "omitempty" option, the zero values
+//The fields of a nested struct are named after it ("cache_hits"), and the fields of an embedded struct as the fields of the struct itself
+//The time.Time field with the "time" option is the time of the point, when t is zero
+func StructPoint(measurement string, v interface{}, t time.Time) (*v2.Point, *errors.Error) {
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, errors.New(fmt.Sprintf("the value must be a struct, not %T", v))
+	}
+
+	tags := map[string]string{}
+	fields := map[string]interface{}{}
+
+	e := structPoint(value, "", tags, fields, &t)
+	err := errors.WrapInner(fmt.Sprintf("error mapping %T to a point", v), e, 0)
+
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(fmt.Sprintf("%T has no field to write, a point needs at least one", v))
+	}
+
+	pt, e := v2.NewPoint(measurement, tags, fields, t)
+	err = errors.WrapInner("error creating a new point", e, 0)
+
+	if err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
+
+//StructPoints builds a point from each item of a slice of structs (or of pointers to structs), as StructPoint
+func StructPoints(measurement string, slice interface{}, t time.Time) ([]*v2.Point, *errors.Error) {
+
+	value := reflect.ValueOf(slice)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, errors.New(fmt.Sprintf("the value must be a slice, not %T", slice))
+	}
+
+	points := make([]*v2.Point, 0, value.Len())
+	for index := 0; index < value.Len(); index++ {
+		pt, err := StructPoint(measurement, value.Index(index).Interface(), t)
+		if err != nil {
+			return nil, errors.WrapInner(fmt.Sprintf("error mapping the item %d", index), err, 0)
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
+
+//structPoint adds the fields of a struct to the tags and the fields of a point, naming them after the prefix
+func structPoint(value reflect.Value, prefix string, tags map[string]string, fields map[string]interface{}, t *time.Time) error {
+
+	for f := 0; f < value.NumField(); f++ {
+		field := value.Type().Field(f)
+		name, options := influxTag(field)
+
+		//the unexported fields (even the embedded ones) can not be read
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		isTag, isTime, omitEmpty := false, false, false
+		for _, option := range options {
+			switch option {
+			case "tag":
+				isTag = true
+			case "field":
+				isTag = false
+			case "time":
+				isTime = true
+			case "omitempty":
+				omitEmpty = true
+			}
+		}
+
+		item := value.Field(f)
+		for item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				break
+			}
+			item = item.Elem()
+		}
+		if item.Kind() == reflect.Ptr || (omitEmpty && item.IsZero()) {
+			continue
+		}
+
+		if isTime {
+			if item.Type() != timeType {
+				return fmt.Errorf("the time field %s must be a time.Time, not %s", field.Name, item.Type())
+			}
+			if t.IsZero() {
+				*t = item.Interface().(time.Time)
+			}
+			continue
+		}
+
+		if item.Kind() == reflect.Struct && item.Type() != timeType {
+			inner := prefix
+			if !field.Anonymous {
+				inner = prefix + name + "_"
+			}
+			if e := structPoint(item, inner, tags, fields, t); e != nil {
+				return e
+			}
+			continue
+		}
+
+		if isTag {
+			//influx does not store empty tags
+			if text := fmt.Sprint(item.Interface()); text != "" {
+				tags[prefix+name] = text
+			}
+			continue
+		}
+
+		fieldValue, e := influxFieldValue(item)
+		if e != nil {
+			return fmt.Errorf("the field %s: %s", field.Name, e.Error())
+		}
+		fields[prefix+name] = fieldValue
+	}
+
+	return nil
+}
+
+//influxFieldValue converts a value to one of the types of the influx fields: int64, float64, bool and string
+//The unsigned integers are written as integers, as influx 1.x does not accept unsigned fields by default
+func influxFieldValue(value reflect.Value) (interface{}, error) {
+
+	if value.Type() == timeType {
+		return value.Interface().(time.Time).UnixNano(), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows an influx integer", value.Uint())
+		}
+		return int64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		return value.String(), nil
+	default:
+		return nil, fmt.Errorf("unable to write %s as an influx field", value.Type())
+	}
+}
+
+//WriteStruct writes a single point built from the struct, as StructPoint
+func (i *Influx) WriteStruct(measurement string, v interface{}, t time.Time) *errors.Error {
+
+	pt, err := StructPoint(measurement, v, t)
+	if err != nil {
+		return err
+	}
+	return i.write([]*v2.Point{pt})
+}
+
+//WriteStructs writes the points built from the items of the slice in a single batch, as StructPoints
+func (i *Influx) WriteStructs(measurement string, slice interface{}, t time.Time) *errors.Error {
+
+	points, err := StructPoints(measurement, slice, t)
+	if err != nil {
+		return err
+	}
+	return i.WritePoints(points)
+}
+
+//WriteStruct writes a single point built from the struct, as StructPoint
+func (i *Influx2) WriteStruct(measurement string, v interface{}, t time.Time) *errors.Error {
+
+	pt, err := StructPoint(measurement, v, t)
+	if err != nil {
+		return err
+	}
+	return i.WritePoints([]*v2.Point{pt})
+}
+
+//WriteStructs writes the points built from the items of the slice in a single request, as StructPoints
+func (i *Influx2) WriteStructs(measurement string, slice interface{}, t time.Time) *errors.Error {
+
+	points, err := StructPoints(measurement, slice, t)
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	return i.WritePoints(points)
+}
+
+//WriteStruct adds a point built from the struct to the buffer, as StructPoint
+func (w *BatchWriter) WriteStruct(measurement string, v interface{}, t time.Time) *errors.Error {
+
+	pt, err := StructPoint(measurement, v, t)
+	if err != nil {
+		return err
+	}
+	return w.add(pt)
+}
+
+//WriteStructs adds the points built from the items of the slice to the buffer, as StructPoints
+//No point is added when an item can not be mapped
+func (w *BatchWriter) WriteStructs(measurement string, slice interface{}, t time.Time) *errors.Error {
+
+	points, err := StructPoints(measurement, slice, t)
+	if err != nil {
+		return err
+	}
+	for _, pt := range points {
+		if err = w.add(pt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,8 +1,8 @@
 package golib
 
 import (
-	"fmt"
-	"net"
+	"context"
+	"sync"
 	"time"
 
 	"github.com/felipefoliatti/backoff"
@@ -11,12 +11,25 @@ import (
 	v2 "github.com/influxdata/influxdb1-client/v2"
 )
 
+// MetricsWriter writes points to a time series database
+// It is implemented by Influx (InfluxDB 1.x) and by Influx2 (InfluxDB 2.x)
+type MetricsWriter interface {
+	Write(measurement string, fields map[string]interface{}, tags map[string]string, time time.Time) *errors.Error
+	WritePoints(points []*v2.Point) *errors.Error
+	Ping(ctx context.Context) *errors.Error
+}
+
+// Influx writes to InfluxDB 1.x
 type Influx struct {
 	url       string
 	database  string
-	client    v2.Client
 	retention string
 	duration  string
+	options   InfluxOptions
+
+	//the client is shared by the writes of a BatchWriter, the queries and the health checks, and is created again after a connection error
+	mutex  sync.Mutex
+	client v2.Client
 }
 
 func (i *Influx) Write(measurement string, fields map[string]interface{}, tags map[string]string, time time.Time) *errors.Error {
@@ -24,127 +37,255 @@ func (i *Influx) Write(measurement string, fields map[string]interface{}, tags m
 	var e error
 	var err *errors.Error
 
-	// Create a new point batch
-	bp, e := v2.NewBatchPoints(v2.BatchPointsConfig{
-		Database:        i.database,
-		Precision:       "ns",
-		RetentionPolicy: i.retention,
-		// RetentionPolicy: "720d",
-	})
+	var pt *v2.Point
+	pt, e = v2.NewPoint(measurement, tags, fields, time)
 
-	err = errors.WrapInner("error creating a batch point", e, 0)
+	err = errors.WrapInner("error creating a new point", e, 0)
 	if err != nil {
 		return err
 	}
 
-	var pt *v2.Point
-	pt, e = v2.NewPoint(measurement, tags, fields, time)
+	return i.write([]*v2.Point{pt})
+}
 
-	err = errors.WrapInner("error creating a new point", e, 0)
+// WritePoints writes the points in a single batch, retrying it 3 times
+func (i *Influx) WritePoints(points []*v2.Point) *errors.Error {
+	if len(points) == 0 {
+		return nil
+	}
+	return i.write(points)
+}
+
+// write sends the points in a single batch, retrying it 3 times
+func (i *Influx) write(points []*v2.Point) *errors.Error {
+
+	var e error
+	var err *errors.Error
+
+	// Create a new point batch (the precision is set apart, see influxBatch)
+	bp, e := v2.NewBatchPoints(v2.BatchPointsConfig{
+		Database:         i.database,
+		RetentionPolicy:  i.retention,
+		WriteConsistency: i.options.WriteConsistency,
+		// RetentionPolicy: "720d",
+	})
+
+	err = errors.WrapInner("error creating a batch point", e, 0)
 	if err != nil {
 		return err
 	}
 
-	bp.AddPoint(pt)
+	bp.AddPoints(points)
+	batch := influxBatch{BatchPoints: bp, precision: i.options.Precision}
 
 	e = backoff.Retry(func() error {
 
 		var e error
 		var err *errors.Error
 
-		if i.client == nil {
-			var c v2.Client
-			c, e = v2.NewHTTPClient(v2.HTTPConfig{
-				Addr:     i.url,
-				Username: "root",
-				Password: "root",
-			})
-
-			err = errors.WrapInner("error creating the http client", e, 0)
-			if err == nil {
-				i.client = c
-			}
-		}
+		client, err := i.connect()
 
 		//if no error connecting
 		if err == nil {
 
 			// Write the batch
-			e = i.client.Write(bp)
-			err = errors.WrapInner("error writing the points to influx", e, 0)
+			e = client.Write(batch)
+			err = influxError("error writing the points to influx", e)
 			//fmt.Println("ESCRITO! : -  " + golib.TryError(e))
 
 			// If any connection error
-			if err != nil {
-				var ok bool
-				if _, ok = err.Root().(net.Error); ok {
-					i.client = nil
-				}
+			if err != nil && *err.Code == InfluxNetworkError {
+				i.reset(client)
 			}
 		}
 
+		if err == nil {
+			return nil
+		}
+
+		// The points rejected by the server are rejected again in the next attempts
+		if !retriesInflux(err) {
+			return backoff.Permanent(err)
+		}
 		return err
 	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
-	err = e.(*errors.Error)
 
-	return err
+	return errors.Wrap(e, 0)
 }
 
-// queryDB convenience function to query the database
-func (i *Influx) Query(cmd string) ([]v2.Result, *errors.Error) {
+// Ping checks if the influx server is reachable, waiting at most until the context is done
+func (i *Influx) Ping(ctx context.Context) *errors.Error {
 
+	var e error
 	var err *errors.Error
+
+	client, err := i.connect()
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, e := client.Ping(timeout)
+		done <- e
+	}()
+
+	select {
+	case e = <-done:
+		return influxError("error pinging the influx database", e)
+	case <-ctx.Done():
+		return errors.WrapInnerWithCode("timeout pinging the influx database", InfluxNetworkError, ctx.Err(), 0)
+	}
+}
+
+// Query runs a command in the database, retrying it 3 times as Write does
+func (i *Influx) Query(cmd string) ([]v2.Result, *errors.Error) {
+	return i.QueryWithParams(cmd, nil)
+}
+
+// QueryWithParams runs a command with bound parameters, referenced in the command as $name
+// The values are sent apart from the command, so they are never parsed as part of it and do not need to be escaped
+//
+//	influx.QueryWithParams("SELECT * FROM cpu WHERE host = $host", map[string]interface{}{"host": host})
+func (i *Influx) QueryWithParams(cmd string, params map[string]interface{}) ([]v2.Result, *errors.Error) {
+
+	var e error
 	var res []v2.Result
 
 	q := v2.Query{
 		Command:         cmd,
 		Database:        i.database,
 		RetentionPolicy: i.retention,
+		Parameters:      params,
 	}
-	if response, e := i.client.Query(q); e == nil {
 
+	e = backoff.Retry(func() error {
+
+		var e error
+		var err *errors.Error
+
+		client, err := i.connect()
+		if err != nil {
+			return err
+		}
+
+		var response *v2.Response
+		response, e = client.Query(q)
+		err = influxError("error querying the influx database", e)
+
+		// If any connection error, the client is created again in the next attempt
+		if err != nil {
+			if *err.Code == InfluxNetworkError {
+				i.reset(client)
+			}
+			if !retriesInflux(err) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+
+		// The errors of the statements are not retried
 		if response.Error() != nil {
-			err = errors.WrapInner("error querying the influx database", response.Error(), 0)
-			return res, err
+			return backoff.Permanent(influxError("error querying the influx database", response.Error()))
 		}
+
 		res = response.Results
+		return nil
+	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
 
-	} else {
-		return res, errors.WrapInner("error querying the influx database", e, 0)
+	if e != nil {
+		return nil, errors.Wrap(e, 0)
 	}
 	return res, nil
 }
 
+// QueryInto runs a command with bound parameters (that can be nil), decoding its series into target as DecodeSeries does
+func (i *Influx) QueryInto(target interface{}, cmd string, params map[string]interface{}) *errors.Error {
+
+	res, err := i.QueryWithParams(cmd, params)
+	if err != nil {
+		return err
+	}
+	return DecodeSeries(res, target)
+}
+
+// connect returns the client, creating it when there is none, as after a connection error
+// Each call works on the client returned, so a reset by another goroutine does not affect it
+func (i *Influx) connect() (v2.Client, *errors.Error) {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.client != nil {
+		return i.client, nil
+	}
+
+	c, e := v2.NewHTTPClient(i.options.httpConfig(i.url))
+	err := errors.WrapInner("error creating the http client", e, 0)
+
+	if err != nil {
+		return nil, err
+	}
+	i.client = c
+	return c, nil
+}
+
+// reset drops the client that failed, so the next call creates another one
+// A client already created again by another goroutine is kept
+func (i *Influx) reset(client v2.Client) {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.client == client {
+		i.client = nil
+	}
+}
+
+// NewInflux creates the connection to influx with the default options, creating the database and the retention policy
 func NewInflux(database string, host string, port string, retention string, duration string) (*Influx, *errors.Error) {
+	return NewInfluxWithOptions(database, host, port, retention, duration, DefaultInfluxOptions())
+}
+
+// NewInfluxWithOptions creates the connection to influx with the given options, creating the database and the retention policy
+// The empty options are taken from DefaultInfluxOptions, and a host without a scheme uses http (https when TLS is set)
+func NewInfluxWithOptions(database string, host string, port string, retention string, duration string, options InfluxOptions) (*Influx, *errors.Error) {
 
 	var err *errors.Error
-	var e error
+
+	defaults := DefaultInfluxOptions()
+	if options.Username == "" && options.Password == "" {
+		options.Username = defaults.Username
+		options.Password = defaults.Password
+	}
+	if options.Replication <= 0 {
+		options.Replication = defaults.Replication
+	}
+
+	//an unknown precision would shift the timestamps of all the points, so it fails before connecting
+	options.Precision, err = influxPrecision(options.Precision)
+	if err != nil {
+		return nil, err
+	}
 
 	obj := &Influx{}
-	obj.url = host + ":" + port
+	obj.options = options
+	obj.url = influxAddress(host, port, options)
 	obj.database = database
 	obj.retention = retention
 	obj.duration = duration
 
-	//try to connect 3 times
-	e = backoff.Retry(func() error {
-		c, e := v2.NewHTTPClient(v2.HTTPConfig{
-			Addr:     obj.url,
-			Username: "root",
-			Password: "root",
-		})
-		obj.client = c
-
-		return errors.WrapInner("error connecting to influx database", e, 0)
-	}, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
-	err = e.(*errors.Error)
-
-	if err == nil {
-		_, err = obj.Query(fmt.Sprintf("CREATE DATABASE %s", obj.database))
-	}
+	//the client only fails with an invalid address, so it is not retried
+	_, err = obj.connect()
+	err = errors.WrapInner("error connecting to influx database", err, 0)
 
-	if err == nil {
-		_, err = obj.Query(fmt.Sprintf("CREATE RETENTION POLICY \"%s\" ON \"%s\" DURATION %s REPLICATION 1", obj.retention, obj.database, obj.duration))
+	if err == nil && !options.SkipProvisioning {
+		err = obj.provision()
 	}
 
 	return obj, err
@@ -0,0 +1,67 @@
+package golib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxWritePrecision(t *testing.T) {
+
+	cases := []struct {
+		precision string
+		query     string
+		timestamp string
+	}{
+		{"", "ns", "1600000000123456789"},
+		{"us", "u", "1600000000123456"},
+		{"u", "u", "1600000000123456"},
+		{"ms", "ms", "1600000000123"},
+		{"s", "s", "1600000000"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+
+			var query, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				query, body = r.URL.Query().Get("precision"), string(data)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			options := DefaultInfluxOptions()
+			options.SkipProvisioning = true
+			options.Precision = c.precision
+
+			influx, err := NewInfluxWithOptions("metrics", server.URL, "", "", "", options)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			err = influx.Write("cpu", map[string]interface{}{"value": 1}, nil, time.Unix(1600000000, 123456789))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			if query != c.query || !strings.HasSuffix(strings.TrimSpace(body), " "+c.timestamp) {
+				t.Errorf("expected precision=%s and the timestamp %s, got precision=%s and %q", c.query, c.timestamp, query, body)
+			}
+		})
+	}
+}
+
+func TestInfluxRejectsUnknownPrecision(t *testing.T) {
+
+	options := DefaultInfluxOptions()
+	options.SkipProvisioning = true
+	options.Precision = "µs"
+
+	if _, err := NewInfluxWithOptions("metrics", "localhost", "8086", "", "", options); err == nil {
+		t.Fatal("expected an error for an unknown precision")
+	}
+}
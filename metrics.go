@@ -0,0 +1,99 @@
+package golib
+
+import (
+	"time"
+
+	"github.com/felipefoliatti/errors"
+)
+
+//Metrics records the measurements of the service, so the code does not depend on where they are stored
+//The tags (labels) identify the series of a metric, and must have a small number of distinct values
+type Metrics interface {
+	//Counter adds the value to a metric that only increases, as the number of requests
+	Counter(name string, value float64, tags map[string]string)
+	//Gauge sets the current value of a metric, as the size of a queue
+	Gauge(name string, value float64, tags map[string]string)
+	//Histogram records a value of a distribution, as the size of the responses
+	Histogram(name string, value float64, tags map[string]string)
+	//Timer records a duration, as the latency of the requests
+	Timer(name string, duration time.Duration, tags map[string]string)
+}
+
+//StartTimer starts timing an operation, recording it in the Timer of the metrics when the returned function is called
+//
+//	defer golib.StartTimer(metrics, "import_duration", nil)()
+func StartTimer(metrics Metrics, name string, tags map[string]string) func() {
+	start := time.Now()
+	return func() {
+		metrics.Timer(name, time.Since(start), tags)
+	}
+}
+
+//ObserveOperation records an operation of a component that started at start: the counter "<component>_operations"
+//and the timer "<component>_operation_duration", tagged by the tags and by the status of the operation ("ok" or "error")
+//
+//	start := time.Now()
+//	err := cache.Load()
+//	golib.ObserveOperation(metrics, "cache", map[string]string{"operation": "load"}, start, err)
+func ObserveOperation(metrics Metrics, component string, tags map[string]string, start time.Time, err *errors.Error) {
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	copied := map[string]string{"status": status}
+	for key, value := range tags {
+		copied[key] = value
+	}
+
+	metrics.Counter(component+"_operations", 1, copied)
+	metrics.Timer(component+"_operation_duration", time.Since(start), copied)
+}
+
+//PointWriter writes a single point, as Influx, Influx2 and BatchWriter do
+type PointWriter interface {
+	Write(measurement string, fields map[string]interface{}, tags map[string]string, time time.Time) *errors.Error
+}
+
+//InfluxMetrics records the metrics as influx points, one for each measurement, in the measurement of the name of the metric
+//The counters are written in the field "count", the gauges and the histograms in the field "value"
+//and the timers in the field "duration_ms". A BatchWriter avoids a request for each point
+type InfluxMetrics struct {
+	writer PointWriter
+	logger Logger
+}
+
+//NewInfluxMetrics creates the metrics written to the writer, logging the failed writes through the logger (that can be nil)
+func NewInfluxMetrics(writer PointWriter, logger Logger) *InfluxMetrics {
+	return &InfluxMetrics{writer: writer, logger: logger}
+}
+
+func (m *InfluxMetrics) Counter(name string, value float64, tags map[string]string) {
+	m.write(name, "count", value, tags)
+}
+
+func (m *InfluxMetrics) Gauge(name string, value float64, tags map[string]string) {
+	m.write(name, "value", value, tags)
+}
+
+func (m *InfluxMetrics) Histogram(name string, value float64, tags map[string]string) {
+	m.write(name, "value", value, tags)
+}
+
+func (m *InfluxMetrics) Timer(name string, duration time.Duration, tags map[string]string) {
+	m.write(name, "duration_ms", float64(duration)/float64(time.Millisecond), tags)
+}
+
+func (m *InfluxMetrics) write(name string, field string, value float64, tags map[string]string) {
+
+	err := m.writer.Write(name, map[string]interface{}{field: value}, tags, time.Now())
+
+	if err != nil && m.logger != nil {
+		m.logger.LogA(WARN, map[string]interface{}{
+			"message": "error writing the metric",
+			"metric":  name,
+			"error":   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package golib
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DefaultBuckets are the upper bounds of the buckets of the histograms, in seconds for the timers
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//PrometheusMetrics keeps the metrics in memory and exposes them in the Prometheus text format, through Handler
+//The timers are histograms in seconds, named with the "_seconds" suffix
+//
+//	metrics := golib.NewPrometheusMetrics()
+//	mux.Handle("/metrics", metrics.Handler())
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mutex    sync.Mutex
+	families map[string]*promFamily
+}
+
+//promFamily holds the series of a metric
+type promFamily struct {
+	kind   string
+	series map[string]*promSeries
+}
+
+//promSeries holds the value of a metric for a set of labels
+type promSeries struct {
+	labels string
+	value  float64
+	counts []uint64 //of each bucket, in the histograms
+	sum    float64
+	count  uint64
+}
+
+//NewPrometheusMetrics creates the metrics, with the upper bounds of the buckets of the histograms (DefaultBuckets when empty)
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	return &PrometheusMetrics{buckets: sorted, families: map[string]*promFamily{}}
+}
+
+func (p *PrometheusMetrics) Counter(name string, value float64, tags map[string]string) {
+	if value < 0 {
+		return
+	}
+	p.record(name, "counter", tags, func(s *promSeries) {
+		s.value += value
+	})
+}
+
+func (p *PrometheusMetrics) Gauge(name string, value float64, tags map[string]string) {
+	p.record(name, "gauge", tags, func(s *promSeries) {
+		s.value = value
+	})
+}
+
+func (p *PrometheusMetrics) Histogram(name string, value float64, tags map[string]string) {
+	p.record(name, "histogram", tags, func(s *promSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+		for b, bound := range p.buckets {
+			if value <= bound {
+				s.counts[b]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+func (p *PrometheusMetrics) Timer(name string, duration time.Duration, tags map[string]string) {
+	p.Histogram(name+"_seconds", duration.Seconds(), tags)
+}
+
+//record updates the series of the labels, ignoring a metric already registered with another type
+func (p *PrometheusMetrics) record(name string, kind string, tags map[string]string, update func(s *promSeries)) {
+
+	name = promName(name)
+	labels := promLabels(tags)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	f, ok := p.families[name]
+	if !ok {
+		f = &promFamily{kind: kind, series: map[string]*promSeries{}}
+		p.families[name] = f
+	}
+	if f.kind != kind {
+		return
+	}
+
+	s, ok := f.series[labels]
+	if !ok {
+		s = &promSeries{labels: labels}
+		f.series[labels] = s
+	}
+	update(s)
+}
+
+//Handler serves the metrics in the Prometheus text format
+func (p *PrometheusMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		p.write(w)
+	})
+}
+
+//write writes all the metrics, sorted by name and labels
+func (p *PrometheusMetrics) write(w io.Writer) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := p.families[name]
+		out.WriteString("# TYPE " + name + " " + f.kind + "\n")
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+
+			if f.kind != "histogram" {
+				out.WriteString(name + promBraces(s.labels) + " " + promValue(s.value) + "\n")
+				continue
+			}
+
+			for b, bound := range p.buckets {
+				out.WriteString(name + "_bucket" + promBraces(promJoin(s.labels, `le="`+promValue(bound)+`"`)) + " " + strconv.FormatUint(s.counts[b], 10) + "\n")
+			}
+			out.WriteString(name + "_bucket" + promBraces(promJoin(s.labels, `le="+Inf"`)) + " " + strconv.FormatUint(s.count, 10) + "\n")
+			out.WriteString(name + "_sum" + promBraces(s.labels) + " " + promValue(s.sum) + "\n")
+			out.WriteString(name + "_count" + promBraces(s.labels) + " " + strconv.FormatUint(s.count, 10) + "\n")
+		}
+	}
+}
+
+var invalidPromName = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+//promName replaces the characters not allowed in the names of Prometheus (as "." and "-") by "_"
+func promName(name string) string {
+	name = invalidPromName.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+//promLabels formats the tags as the labels of a series, sorted by name (as `host="a",method="GET"`)
+func promLabels(tags map[string]string) string {
+
+	labels := make([]string, 0, len(tags))
+	for key, value := range tags {
+		key = strings.Replace(promName(key), ":", "_", -1)
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		labels = append(labels, key+`="`+value+`"`)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+//promValue formats a value as Prometheus does, including the infinities
+func promValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+//promJoin adds a label to the labels of a series
+func promJoin(labels string, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+//promBraces wraps the labels of a series, when there is any
+func promBraces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
@@ -0,0 +1,74 @@
+package amq
+
+import (
+	"context"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	"github.com/felipefoliatti/golib"
+)
+
+// instrumentedQueue records the operations of a Queue in the metrics
+type instrumentedQueue struct {
+	queue   Queue
+	name    string
+	metrics golib.Metrics
+}
+
+// NewInstrumentedQueue wraps the queue, recording each operation in the metrics:
+// the counter "queue_operations" and the timer "queue_operation_duration", tagged by queue, operation and status ("ok" or "error")
+// The messages read are also counted in "queue_messages_read"
+func NewInstrumentedQueue(queue Queue, name string, metrics golib.Metrics) Queue {
+	return &instrumentedQueue{queue: queue, name: name, metrics: metrics}
+}
+
+func (q *instrumentedQueue) Send(content *string) (*string, *errors.Error) {
+	start := time.Now()
+	id, err := q.queue.Send(content)
+	q.observe("send", start, err)
+	return id, err
+}
+
+func (q *instrumentedQueue) Read() ([]*Message, *errors.Error) {
+	start := time.Now()
+	messages, err := q.queue.Read()
+	q.observe("read", start, err)
+
+	if len(messages) > 0 {
+		q.metrics.Counter("queue_messages_read", float64(len(messages)), map[string]string{"queue": q.name})
+	}
+	return messages, err
+}
+
+func (q *instrumentedQueue) Postpone(message *Message) *errors.Error {
+	start := time.Now()
+	err := q.queue.Postpone(message)
+	q.observe("postpone", start, err)
+	return err
+}
+
+func (q *instrumentedQueue) Ack(message *Message) *errors.Error {
+	start := time.Now()
+	err := q.queue.Ack(message)
+	q.observe("ack", start, err)
+	return err
+}
+
+func (q *instrumentedQueue) NAck(message *Message) *errors.Error {
+	start := time.Now()
+	err := q.queue.NAck(message)
+	q.observe("nack", start, err)
+	return err
+}
+
+func (q *instrumentedQueue) Ping(ctx context.Context) *errors.Error {
+	start := time.Now()
+	err := golib.Ping(ctx, q.queue)
+	q.observe("ping", start, err)
+	return err
+}
+
+// observe records an operation that started at start
+func (q *instrumentedQueue) observe(operation string, start time.Time, err *errors.Error) {
+	golib.ObserveOperation(q.metrics, "queue", map[string]string{"queue": q.name, "operation": operation}, start, err)
+}
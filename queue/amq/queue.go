@@ -1,6 +1,7 @@
 package amq
 
 import (
+	"context"
 	"crypto/tls"
 	"math"
 	"net"
@@ -378,3 +379,41 @@ func (q *amqQueue) Postpone(msg *Message) *errors.Error {
 	q.wait = time.Second
 	return nil
 }
+
+// Ping checks if the queue is reachable, opening the write connection if needed
+// An empty transaction is begun and aborted, so a broken connection is detected without sending any message
+func (q *amqQueue) Ping(ctx context.Context) *errors.Error {
+
+	done := make(chan *errors.Error, 1)
+
+	go func() {
+		if _, ok := q.conn.Load(WRITE); !ok {
+			if err := q.connect(WRITE); err != nil {
+				done <- err
+				return
+			}
+		}
+
+		obj, _ := q.conn.Load(WRITE)
+		queue := obj.(*stomp.Conn)
+
+		tx, e := queue.BeginWithError()
+		if e == nil {
+			e = tx.Abort()
+		}
+		err := errors.WrapInner("the connection to queue is broken", e, 0)
+
+		if err != nil {
+			queue.Disconnect()
+			q.conn.Delete(WRITE)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.WrapInner("timeout checking the connection to queue", ctx.Err(), 0)
+	}
+}
@@ -0,0 +1,60 @@
+package sqs
+
+import (
+	"context"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	"github.com/felipefoliatti/golib"
+)
+
+// instrumentedQueue registra as operações de uma Queue nas métricas
+type instrumentedQueue struct {
+	queue   Queue
+	name    string
+	metrics golib.Metrics
+}
+
+// NewInstrumentedQueue envolve a fila, registrando cada operação nas métricas:
+// o contador "queue_operations" e o timer "queue_operation_duration", com as tags queue, operation e status ("ok" ou "error")
+// As mensagens lidas também são contadas em "queue_messages_read"
+func NewInstrumentedQueue(queue Queue, name string, metrics golib.Metrics) Queue {
+	return &instrumentedQueue{queue: queue, name: name, metrics: metrics}
+}
+
+func (q *instrumentedQueue) Send(content *string) (*string, *errors.Error) {
+	start := time.Now()
+	id, err := q.queue.Send(content)
+	q.observe("send", start, err)
+	return id, err
+}
+
+func (q *instrumentedQueue) Read() ([]*Message, *errors.Error) {
+	start := time.Now()
+	messages, err := q.queue.Read()
+	q.observe("read", start, err)
+
+	if len(messages) > 0 {
+		q.metrics.Counter("queue_messages_read", float64(len(messages)), map[string]string{"queue": q.name})
+	}
+	return messages, err
+}
+
+func (q *instrumentedQueue) Delete(handle *string) *errors.Error {
+	start := time.Now()
+	err := q.queue.Delete(handle)
+	q.observe("delete", start, err)
+	return err
+}
+
+func (q *instrumentedQueue) Ping(ctx context.Context) *errors.Error {
+	start := time.Now()
+	err := golib.Ping(ctx, q.queue)
+	q.observe("ping", start, err)
+	return err
+}
+
+// observe registra uma operação iniciada em start
+func (q *instrumentedQueue) observe(operation string, start time.Time, err *errors.Error) {
+	golib.ObserveOperation(q.metrics, "queue", map[string]string{"queue": q.name, "operation": operation}, start, err)
+}
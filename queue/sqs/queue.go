@@ -1,6 +1,7 @@
 package sqs
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strconv"
@@ -175,3 +176,9 @@ func (q *sqsQueue) Delete(handle *string) *errors.Error {
 	err = errors.WrapInner("unable to delete message", e, 0)
 	return err
 }
+
+// Ping verifica se a fila está acessível, consultando a sua URL
+func (q *sqsQueue) Ping(ctx context.Context) *errors.Error {
+	_, e := q.svc.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: q.name})
+	return errors.WrapInner("unable to get the queue", e, 0)
+}
@@ -0,0 +1,77 @@
+package golib
+
+import (
+	"context"
+	"encoding/json"
+)
+
+//RequestIDHeader is the header that carries the request id among the services
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+//WithRequestID returns a copy of the context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+//RequestID returns the request id carried by the context, or an empty string
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+//ContextLogger returns a Logger that adds the request id of the context ("request_id") to all its entries
+//If the context has no request id, the logger itself is returned
+func ContextLogger(ctx context.Context, logger Logger) Logger {
+	id := RequestID(ctx)
+	if id == "" || logger == nil {
+		return logger
+	}
+	return &requestLogger{logger: logger, id: id}
+}
+
+//requestLogger is a Logger that adds the request id to the entries of another Logger
+type requestLogger struct {
+	logger Logger
+	id     string
+}
+
+func (l *requestLogger) LogIf(canlog bool, level Level, data func() Data, action func(*string)) {
+	l.logger.LogAIf(canlog, level, func() interface{} { return l.with(data()) }, action)
+}
+
+func (l *requestLogger) Log(level Level, data Data) {
+	l.logger.LogA(level, l.with(data))
+}
+
+func (l *requestLogger) LogAIf(canlog bool, level Level, data func() interface{}, action func(*string)) {
+	l.logger.LogAIf(canlog, level, func() interface{} { return l.with(data()) }, action)
+}
+
+func (l *requestLogger) LogA(level Level, data interface{}) {
+	l.logger.LogA(level, l.with(data))
+}
+
+func (l *requestLogger) LogAIf2(canlog bool, level Level, data interface{}) {
+	l.logger.LogAIf2(canlog, level, l.with(data))
+}
+
+//with converts the data to a map, as the LoggerImpl does, adding the request id
+func (l *requestLogger) with(data interface{}) interface{} {
+
+	m := make(map[string]interface{})
+
+	if data != nil {
+		record, _ := json.Marshal(data)
+		json.Unmarshal(record, &m)
+	}
+
+	m["request_id"] = l.id
+	return m
+}
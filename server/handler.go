@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/felipefoliatti/errors"
+	"github.com/felipefoliatti/golib"
+)
+
+//HandlerFunc handles a request, returning the object written as the detail of the envelope or an error
+type HandlerFunc func(r *http.Request) (interface{}, *errors.Error)
+
+//Envelope is the body written by the handlers, the same one parsed by golib.EnvelopeErrorDecoder
+//On success, Detail is the object returned by the HandlerFunc; on error, it is an ErrorDetail
+type Envelope struct {
+	Success bool        `json:"success"`
+	Code    *int        `json:"code,omitempty"`
+	Detail  interface{} `json:"detail,omitempty"`
+}
+
+//ErrorDetail is the detail of the envelope of an error
+type ErrorDetail struct {
+	Message string `json:"message"`
+}
+
+//Response can be returned by a HandlerFunc to choose the status code and the headers of a successful response
+type Response struct {
+	Status int
+	Header http.Header
+	Detail interface{}
+}
+
+//StatusMapper chooses the status code of an error
+type StatusMapper func(err *errors.Error) int
+
+//DefaultStatus uses the code of the error when it is a http status code (4xx or 5xx)
+//Errors of calls to other services (golib.HTTPError) are 502, even when their code is the status answered by the other service,
+//so it is not passed to the caller (CodeStatus maps them otherwise). Any other error is 500
+func DefaultStatus(err *errors.Error) int {
+
+	if _, ok := err.Root().(*golib.HTTPError); ok {
+		return http.StatusBadGateway
+	}
+
+	if err.Code != nil && *err.Code >= 400 && *err.Code <= 599 {
+		return *err.Code
+	}
+
+	return http.StatusInternalServerError
+}
+
+//CodeStatus maps the application codes of the errors to status codes, falling back to DefaultStatus
+func CodeStatus(codes map[int]int) StatusMapper {
+	return func(err *errors.Error) int {
+		if err.Code != nil {
+			if status, ok := codes[*err.Code]; ok {
+				return status
+			}
+		}
+		return DefaultStatus(err)
+	}
+}
+
+//Option configures a handler
+type Option func(h *handler)
+
+//WithStatusMapper sets how the errors are mapped to status codes (DefaultStatus by default)
+func WithStatusMapper(mapper StatusMapper) Option {
+	return func(h *handler) {
+		h.status = mapper
+	}
+}
+
+type handler struct {
+	logger golib.Logger
+	fn     HandlerFunc
+	status StatusMapper
+}
+
+//Handle adapts a HandlerFunc to a http.Handler, writing its result or its error in the envelope
+//Panics are recovered and answered as 500, and the errors are logged through the logger
+func Handle(logger golib.Logger, fn HandlerFunc, options ...Option) http.Handler {
+
+	h := &handler{logger: logger, fn: fn, status: DefaultStatus}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	defer func() {
+		if p := recover(); p != nil {
+			err := errors.WrapInner("panic handling the request", errors.Wrap(p, 2), 0)
+			h.fail(w, r, err, http.StatusInternalServerError, "internal server error")
+		}
+	}()
+
+	result, err := h.fn(r)
+
+	if err != nil {
+		message := err.Error()
+		if err.Message != nil {
+			message = *err.Message
+		}
+		h.fail(w, r, err, h.status(err), message)
+		return
+	}
+
+	status := http.StatusOK
+	var header http.Header
+
+	if response, ok := result.(*Response); ok {
+		if response.Status != 0 {
+			status = response.Status
+		}
+		header = response.Header
+		result = response.Detail
+	}
+
+	for key, values := range header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	write(w, status, Envelope{Success: true, Detail: result})
+}
+
+//fail logs the error and writes its envelope
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, err *errors.Error, status int, message string) {
+
+	if h.logger != nil {
+		level := golib.Level(golib.WARN)
+		if status >= 500 {
+			level = golib.ERROR
+		}
+		golib.ContextLogger(r.Context(), h.logger).LogA(level, map[string]interface{}{
+			"message": "error handling the request",
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"status":  status,
+			"error":   err.Error(),
+			"stack":   err.ErrorStack(),
+		})
+	}
+
+	code := status
+	if err.Code != nil {
+		code = *err.Code
+	}
+
+	write(w, status, Envelope{Success: false, Code: &code, Detail: ErrorDetail{Message: message}})
+}
+
+//write writes the envelope as json
+func write(w http.ResponseWriter, status int, envelope Envelope) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(envelope)
+}
+
+//Decode decodes the json body of the request into v, returning a 400 error when it is invalid
+func Decode(r *http.Request, v interface{}) *errors.Error {
+	e := json.NewDecoder(r.Body).Decode(v)
+	if e != nil {
+		return errors.WrapInnerWithCode(fmt.Sprintf("invalid request body: %s", e.Error()), http.StatusBadRequest, e, 0)
+	}
+	return nil
+}
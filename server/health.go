@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/felipefoliatti/errors"
+	"github.com/felipefoliatti/golib"
+)
+
+//Checker checks a component, returning an error when it is unhealthy
+//The components that implement golib.Pinger (as the databases, Influx and the queues) are registered by RegisterPinger
+type Checker func(ctx context.Context) *errors.Error
+
+//Status is the status of a component or of the whole service
+type Status string
+
+const (
+	//StatusUp is the status of a healthy component
+	StatusUp Status = "up"
+	//StatusDown is the status of an unhealthy component
+	StatusDown Status = "down"
+)
+
+//ComponentStatus is the result of the last check of a component
+type ComponentStatus struct {
+	Status    Status     `json:"status"`
+	Latency   float64    `json:"latency_ms"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt time.Time  `json:"checked_at"`
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+}
+
+//Report is the body written by the health endpoints
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+//CheckOption configures a registered check
+type CheckOption func(c *check)
+
+//WithCheckTimeout sets how long the check can take before the component is down (5 seconds by default)
+func WithCheckTimeout(timeout time.Duration) CheckOption {
+	return func(c *check) {
+		c.timeout = timeout
+	}
+}
+
+//Liveness makes the check part of /healthz too, besides /readyz
+//Only the checks whose failure requires a restart of the service should be in the liveness
+func Liveness() CheckOption {
+	return func(c *check) {
+		c.liveness = true
+	}
+}
+
+//Health aggregates the checks of the components of the service, served as /healthz (liveness) and /readyz (readiness)
+//
+//	health := server.NewHealth(logger)
+//	health.RegisterPinger("database", db)
+//	health.RegisterPinger("queue", queue, server.WithCheckTimeout(10*time.Second))
+//	mux.Handle("/", health.Handler())
+type Health struct {
+	logger golib.Logger
+	mutex  sync.Mutex
+	checks []*check
+}
+
+//check is a registered check and the result of its last run
+type check struct {
+	name     string
+	checker  Checker
+	timeout  time.Duration
+	liveness bool
+
+	mutex  sync.Mutex
+	status ComponentStatus
+}
+
+//NewHealth creates a Health, logging the components that go down or recover through the logger (that can be nil)
+func NewHealth(logger golib.Logger) *Health {
+	return &Health{logger: logger}
+}
+
+//Register adds the check of a component
+func (h *Health) Register(name string, checker Checker, options ...CheckOption) {
+
+	c := &check{name: name, checker: checker, timeout: 5 * time.Second}
+	for _, option := range options {
+		option(c)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks = append(h.checks, c)
+}
+
+//RegisterPinger registers the Ping of a component (as a golib.Database or a sqs.Queue) as its check
+//It fails when the component does not implement golib.Pinger
+func (h *Health) RegisterPinger(name string, component interface{}, options ...CheckOption) *errors.Error {
+
+	pinger, ok := component.(golib.Pinger)
+	if !ok {
+		return errors.New(fmt.Sprintf("the component %s (%T) does not implement Ping", name, component))
+	}
+
+	h.Register(name, pinger.Ping, options...)
+	return nil
+}
+
+//Check runs the checks at the same time, only the liveness ones when readiness is false
+//The service is up when all of them are up
+func (h *Health) Check(ctx context.Context, readiness bool) Report {
+
+	h.mutex.Lock()
+	checks := make([]*check, 0, len(h.checks))
+	for _, c := range h.checks {
+		if readiness || c.liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			c.run(ctx, h.logger)
+		}(c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: map[string]ComponentStatus{}}
+	for _, c := range checks {
+		c.mutex.Lock()
+		report.Components[c.name] = c.status
+		c.mutex.Unlock()
+
+		if report.Components[c.name].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+//Healthz answers the liveness checks, with 200 when up and 503 when down
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, false)
+}
+
+//Readyz answers all the checks, with 200 when up and 503 when down
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+//Handler serves /healthz and /readyz
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+	return mux
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, readiness bool) {
+
+	report := h.Check(r.Context(), readiness)
+
+	status := http.StatusOK
+	if report.Status != StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(report)
+}
+
+//run runs the check, giving up when its timeout ends even if the checker ignores the context
+func (c *check) run(ctx context.Context, logger golib.Logger) {
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan *errors.Error, 1)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- errors.WrapInner("panic checking the component", errors.Wrap(p, 2), 0)
+			}
+		}()
+		done <- c.checker(ctx)
+	}()
+
+	var err *errors.Error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.WrapInner("timeout checking the component", ctx.Err(), 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	previous := c.status.Status
+	c.status.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	c.status.CheckedAt = time.Now()
+	c.status.Status = StatusUp
+	c.status.Error = ""
+
+	if err != nil {
+		failed := c.status.CheckedAt
+		c.status.Status = StatusDown
+		c.status.Error = err.Error()
+		c.status.LastError = err.Error()
+		c.status.FailedAt = &failed
+	}
+
+	if logger == nil || previous == c.status.Status || (previous == "" && err == nil) {
+		return
+	}
+
+	if err != nil {
+		logger.LogA(golib.WARN, map[string]interface{}{
+			"message":   "component is down",
+			"component": c.name,
+			"error":     err.Error(),
+		})
+	} else {
+		logger.LogA(golib.INFO, map[string]interface{}{
+			"message":   "component recovered",
+			"component": c.name,
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/felipefoliatti/golib"
+	uuid "github.com/satori/go.uuid"
+)
+
+//validID accepts the request ids received from other services, avoiding the injection of anything else in the logs
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+//RequestID reads the X-Request-ID header, generating a new id when it is missing or invalid
+//The id is stored in the context of the request (golib.RequestID), so the golib.ContextLogger entries carry it
+//and the golib client forwards it, and it is also sent back in the response header
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get(golib.RequestIDHeader)
+		if !validID.MatchString(id) {
+			id = uuid.NewV4().String()
+		}
+
+		w.Header().Set(golib.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(golib.WithRequestID(r.Context(), id)))
+	})
+}
+
+//statusWriter records the status code and the size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, e := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, e
+}
+
+//Flush keeps the streaming of the wrapped writer working
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//AccessLog logs every request through the logger, with its method, path, status, size, latency and request id
+//It must be placed after RequestID to carry the id: RequestID(AccessLog(logger)(handler))
+func AccessLog(logger golib.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+
+		if logger == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+
+			level := golib.Level(golib.INFO)
+			if sw.status >= 500 {
+				level = golib.ERROR
+			}
+
+			golib.ContextLogger(r.Context(), logger).LogA(level, map[string]interface{}{
+				"message":    "http access",
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"query":      r.URL.RawQuery,
+				"status":     sw.status,
+				"bytes":      sw.bytes,
+				"latency_ms": time.Since(start).Seconds() * 1000,
+				"remote":     r.RemoteAddr,
+				"user_agent": r.UserAgent(),
+			})
+		})
+	}
+}